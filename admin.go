@@ -0,0 +1,628 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dashboard KPIs (GET /api/admin/summary)
+func adminSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var total, hidden, todayCount int
+	revenue := map[string]float64{} // Per currency, totals in different currencies don't add up
+
+	ordersMu.Lock()
+	for _, o := range orders {
+		if o.Deleted {
+			continue
+		}
+		total++
+		if o.Hidden {
+			hidden++
+		}
+		if !o.CreatedAt.Before(today) {
+			todayCount++
+		}
+		// Cancelled orders never brought in money
+		if o.Status != StatusCancelled {
+			revenue[o.Currency] += o.Total
+		}
+	}
+	ordersMu.Unlock()
+	for c, v := range revenue {
+		revenue[c] = math.Round(v*100) / 100
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"total_orders":  total,
+		"live_orders":   total - hidden,
+		"hidden_orders": hidden,
+		"orders_today":  todayCount,
+		"total_revenue": revenue,
+	}, wantPretty(r))
+}
+
+// Soft-delete many orders in one pass (POST /api/admin/orders/bulkDelete {"ids":[1,2]})
+func bulkDeleteOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var in struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeBodyError(w, err, "invalid json")
+		return
+	}
+
+	wanted := make(map[int]bool, len(in.IDs))
+	for _, id := range in.IDs {
+		wanted[id] = true
+	}
+
+	// Soft delete like DELETE /api/orders/{id}, /api/admin/orders/{id} purges for real
+	now := time.Now().UTC()
+	deleted := 0
+	ordersMu.Lock()
+	for i, o := range orders {
+		if wanted[o.ID] && !o.Deleted {
+			delete(wanted, o.ID)
+			orders[i].Deleted = true
+			orders[i].DeletedAt = now
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		touchOrders()
+	}
+	ordersMu.Unlock()
+
+	if deleted > 0 {
+		persistOrders()
+	}
+
+	notFound := []int{}
+	for _, id := range in.IDs {
+		if wanted[id] {
+			notFound = append(notFound, id)
+			delete(wanted, id) // Report duplicates once
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"deleted":   deleted,
+		"not_found": notFound,
+	}, wantPretty(r))
+}
+
+// Orders containing a product, by ?productId= or ?url= (GET /api/admin/orders/byProduct)
+//
+// Scans every order's Items under ordersMu, which blocks writers for the
+// length of the scan. Only matching orders are copied while locked and
+// encoding happens after the lock is released, so a slow client never
+// holds it.
+func ordersByProductHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	productID := 0
+	if v := r.URL.Query().Get("productId"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "bad productId")
+			return
+		}
+		productID = n
+	}
+	imagePath := ""
+	if v := r.URL.Query().Get("url"); v != "" {
+		// Compare paths only, the host differs between environments
+		u, err := url.Parse(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad url")
+			return
+		}
+		imagePath = u.Path
+	}
+	if productID == 0 && imagePath == "" {
+		writeJSONError(w, http.StatusBadRequest, "productId or url required")
+		return
+	}
+
+	matches := []Order{}
+	ordersMu.Lock()
+	for _, o := range orders {
+		if o.Deleted {
+			continue
+		}
+		for _, p := range o.Items {
+			if (productID != 0 && p.ID == productID) || (imagePath != "" && urlPath(p.URL) == imagePath) {
+				matches = append(matches, copyOrder(o))
+				break
+			}
+		}
+	}
+	ordersMu.Unlock()
+
+	writeJSON(w, http.StatusOK, matches, wantPretty(r))
+}
+
+// Path part of a URL, "" if unparsable
+func urlPath(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// Permanently remove an order, e.g. GDPR erasure (DELETE /api/admin/orders/{id})
+func purgeOrderHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/orders/"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	ordersMu.Lock()
+	idx := findOrderIndex(id)
+	if idx == -1 {
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	orders = append(orders[:idx], orders[idx+1:]...)
+	rebuildUsernameIndex() // Splicing shifted every later position
+	touchOrders()
+	ordersMu.Unlock()
+
+	persistOrders()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Latest live orders for the dashboard ticker (GET /api/admin/orders/recent?n=10)
+func recentOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	n := queryInt(r, "n", 10)
+	if n == 0 {
+		n = 10
+	}
+	n = min(n, 100)
+
+	recent := []Order{}
+	ordersMu.Lock()
+	for _, o := range orders {
+		if !o.Hidden && !o.Deleted {
+			recent = append(recent, copyOrder(o))
+		}
+	}
+	ordersMu.Unlock()
+
+	sort.SliceStable(recent, func(i, j int) bool { return recent[i].CreatedAt.After(recent[j].CreatedAt) })
+	recent = paginate(recent, 0, n)
+
+	writeJSON(w, http.StatusOK, recent, wantPretty(r))
+}
+
+// All live orders as a CSV download (GET /api/admin/orders/export.csv)
+func exportOrdersCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	ordersMu.Lock()
+	snapshot := make([]Order, 0, len(orders))
+	for _, o := range orders {
+		if !o.Deleted {
+			snapshot = append(snapshot, copyOrder(o))
+		}
+	}
+	ordersMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="orders.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "username", "created_at", "item_count", "total", "currency", "status", "hidden"})
+	for _, o := range snapshot {
+		cw.Write([]string{
+			strconv.Itoa(o.ID),
+			csvSafe(o.Username),
+			o.CreatedAt.Format(time.RFC3339),
+			strconv.Itoa(itemCount(o)),
+			strconv.FormatFloat(o.Total, 'f', 2, 64),
+			o.Currency,
+			o.Status,
+			strconv.FormatBool(o.Hidden),
+		})
+	}
+	cw.Flush()
+}
+
+// Neutralize values a spreadsheet would run as a formula
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// Units in an order, counting quantities
+func itemCount(o Order) int {
+	n := 0
+	for _, p := range o.Items {
+		n += max(p.Quantity, 1)
+	}
+	return n
+}
+
+// Partial, case-insensitive username match (GET /api/admin/orders/search?username=)
+func searchOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := normalizeUsername(r.URL.Query().Get("username"))
+	if q == "" {
+		writeJSONError(w, http.StatusBadRequest, "username required")
+		return
+	}
+
+	matches := []Order{}
+	ordersMu.Lock()
+	for _, o := range orders {
+		if !o.Deleted && strings.Contains(normalizeUsername(o.Username), q) {
+			matches = append(matches, copyOrder(o))
+		}
+	}
+	ordersMu.Unlock()
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].CreatedAt.After(matches[j].CreatedAt) })
+
+	total := len(matches)
+	offset, limit := orderPageParams(r)
+	matches = paginate(matches, offset, limit)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	writeJSON(w, http.StatusOK, matches, wantPretty(r))
+}
+
+// Longest range byDay will zero-fill
+const maxByDayRange = 366
+
+// Parse a YYYY-MM-DD query param as a UTC midnight
+func queryDay(r *http.Request, key string) (time.Time, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(time.DateOnly, v, time.UTC)
+}
+
+// Orders bucketed by UTC day (GET /api/admin/orders/byDay?from=YYYY-MM-DD&to=YYYY-MM-DD),
+// both ends inclusive; with a full range every day is listed, even empty ones
+func ordersByDayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	from, err := queryDay(r, "from")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid from, want YYYY-MM-DD")
+		return
+	}
+	to, err := queryDay(r, "to")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid to, want YYYY-MM-DD")
+		return
+	}
+	if !from.IsZero() && !to.IsZero() {
+		if to.Before(from) {
+			writeJSONError(w, http.StatusBadRequest, "to is before from")
+			return
+		}
+		if to.Sub(from) >= maxByDayRange*24*time.Hour {
+			writeJSONError(w, http.StatusBadRequest, "range too long, max "+strconv.Itoa(maxByDayRange)+" days")
+			return
+		}
+	}
+
+	type dayBucket struct {
+		Date    string             `json:"date"`
+		Count   int                `json:"count"`
+		Revenue map[string]float64 `json:"revenue"` // Per currency
+	}
+	buckets := map[string]*dayBucket{}
+
+	ordersMu.Lock()
+	for _, o := range orders {
+		if o.Deleted {
+			continue
+		}
+		created := o.CreatedAt.UTC()
+		if !from.IsZero() && created.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !created.Before(to.AddDate(0, 0, 1)) {
+			continue
+		}
+		day := created.Format(time.DateOnly)
+		b := buckets[day]
+		if b == nil {
+			b = &dayBucket{Date: day, Revenue: map[string]float64{}}
+			buckets[day] = b
+		}
+		b.Count++
+		// Same rule as the summary: cancelled orders bring in nothing
+		if o.Status != StatusCancelled {
+			b.Revenue[o.Currency] += o.Total
+		}
+	}
+	ordersMu.Unlock()
+
+	// Empty days still get a bar when the range is bounded
+	if !from.IsZero() && !to.IsZero() {
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			day := d.Format(time.DateOnly)
+			if buckets[day] == nil {
+				buckets[day] = &dayBucket{Date: day, Revenue: map[string]float64{}}
+			}
+		}
+	}
+
+	result := make([]dayBucket, 0, len(buckets))
+	for _, b := range buckets {
+		for c, v := range b.Revenue {
+			b.Revenue[c] = math.Round(v*100) / 100
+		}
+		result = append(result, *b)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Date < result[j].Date })
+
+	writeJSON(w, http.StatusOK, result, wantPretty(r))
+}
+
+// Remote drain requests, consumed by the shutdown goroutine in main
+var shutdownRequests = make(chan string, 1)
+
+// Graceful drain for maintenance (POST /api/admin/shutdown), same path as SIGTERM
+func adminShutdownHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	who := fmt.Sprintf("%s ip=%s request_id=%s", adminIdentity(r), clientIP(r), requestIDFromContext(r.Context()))
+	log.Printf("⚠️ Shutdown requested via admin API by %s", who)
+
+	// Save now so the caller knows the orders made it to disk
+	if err := saveOrders(ordersFile); err != nil {
+		log.Println("Failed to save orders before shutdown:", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to save orders")
+		return
+	}
+
+	select {
+	case shutdownRequests <- who:
+	default: // already shutting down
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]any{"status": "shutting down"}, wantPretty(r))
+}
+
+// Identical image files across all categories (GET /api/admin/images/duplicates),
+// read-only report, nothing is deleted
+func imageDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	type dupFile struct {
+		Category string `json:"category"`
+		Name     string `json:"name"`
+		URL      string `json:"url"`
+	}
+	type dupGroup struct {
+		Hash  string    `json:"sha256"`
+		Size  int64     `json:"size_bytes"`
+		Files []dupFile `json:"files"`
+	}
+
+	// Only files sharing a size can be identical, so hash just those
+	baseURL := requestBaseURL(r)
+	bySize := map[int64][]dupFile{}
+	ctx := r.Context()
+	for _, c := range currentCategories() {
+		files, err := readImageDir(c.Dir())
+		if err != nil {
+			continue // Missing folders have nothing to compare
+		}
+		for _, f := range files {
+			bySize[f.Size] = append(bySize[f.Size], dupFile{
+				Category: c.Folder,
+				Name:     f.Name,
+				URL:      baseURL + "/images/" + url.PathEscape(c.Folder) + "/" + url.PathEscape(f.Name),
+			})
+		}
+	}
+
+	groups := []dupGroup{}
+	for size, candidates := range bySize {
+		if len(candidates) < 2 {
+			continue
+		}
+		byHash := map[string][]dupFile{}
+		for _, f := range candidates {
+			// Stop hashing once the request timed out or the client left
+			if ctx.Err() != nil {
+				return
+			}
+			sum, err := fileSHA256(filepath.Join(imagesDir, f.Category, f.Name))
+			if err != nil {
+				log.Printf("duplicates: hash %s/%s: %v", f.Category, f.Name, err)
+				continue
+			}
+			byHash[sum] = append(byHash[sum], f)
+		}
+		for sum, files := range byHash {
+			if len(files) > 1 {
+				groups = append(groups, dupGroup{Hash: sum, Size: size, Files: files})
+			}
+		}
+	}
+	// Biggest wins first when cleaning up disk
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Hash < groups[j].Hash
+	})
+
+	writeJSON(w, http.StatusOK, groups, wantPretty(r))
+}
+
+// Hex SHA-256 of a file's contents
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Orders written between flushes of the NDJSON stream
+const streamFlushEvery = 100
+
+// Every order as newline-delimited JSON (GET /api/admin/orders/stream?includeDeleted=true),
+// the lock is held only for the snapshot so a slow importer never blocks writes
+func streamOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	includeDeleted := r.URL.Query().Get("includeDeleted") == "true"
+
+	ordersMu.Lock()
+	snapshot := make([]Order, 0, len(orders))
+	for _, o := range orders {
+		if o.Deleted && !includeDeleted {
+			continue
+		}
+		snapshot = append(snapshot, copyOrder(o))
+	}
+	ordersMu.Unlock()
+
+	// Big exports can outlast WriteTimeout, each flush pushes the deadline out
+	rc := http.NewResponseController(w)
+	extend := func() { rc.SetWriteDeadline(time.Now().Add(30 * time.Second)) }
+	extend()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(snapshot)))
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	for i, o := range snapshot {
+		if o.Items == nil {
+			o.Items = []Product{}
+		}
+		if err := enc.Encode(o); err != nil {
+			log.Printf("stream orders: %v", err)
+			return // client went away
+		}
+		if (i+1)%streamFlushEvery == 0 {
+			rc.Flush()
+			extend()
+		}
+	}
+	rc.Flush()
+}
+
+// Re-read categories.json and prices.json and drop listing caches. A file that
+// fails to load keeps its previous config; the result says what happened to each.
+func reloadConfig() (map[string]any, bool) {
+	ok := true
+	result := map[string]any{}
+
+	// Categories first so the price check warns against the new list
+	if err := loadCategories(categoriesFile); err != nil {
+		log.Println("Failed to reload categories:", err)
+		result["categories"] = "error: " + err.Error()
+		ok = false
+	} else {
+		result["categories"] = len(currentCategories())
+	}
+
+	if err := loadPrices(pricesFile); err != nil {
+		log.Println("Failed to reload prices:", err)
+		result["prices"] = "error: " + err.Error()
+		ok = false
+	} else {
+		pricesMu.RLock()
+		result["prices"] = len(categoryPrices)
+		pricesMu.RUnlock()
+	}
+
+	result["dir_cache_cleared"] = clearDirCache()
+	clearStockCache()
+
+	log.Printf("Config reloaded: %v", result)
+	return result, ok
+}
+
+// Reload config and caches without a redeploy (POST /api/admin/reload)
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	result, ok := reloadConfig()
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, result, wantPretty(r))
+}
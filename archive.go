@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Old finished orders are moved here to keep the live list small
+var archiveFile = "archive.json"
+
+// Archival settings, from ARCHIVE_AFTER_DAYS / ARCHIVE_INTERVAL (set in main)
+var (
+	archiveAfterDays = 90
+	archiveInterval  = time.Hour
+)
+
+// Archived orders, oldest first, guarded by archiveMu
+var (
+	archived  []Order
+	archiveMu sync.Mutex
+)
+
+// Load the archive, a missing file means nothing archived yet. Also moves
+// lastOrderID past archived IDs so they are never handed out again.
+func loadArchive(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var loaded []Order
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+
+	archiveMu.Lock()
+	archived = loaded
+	archiveMu.Unlock()
+
+	for _, o := range loaded {
+		if int64(o.ID) > lastOrderID.Load() {
+			lastOrderID.Store(int64(o.ID))
+		}
+	}
+	return nil
+}
+
+// Statuses an order can never leave
+func terminalStatus(status string) bool {
+	return len(allowedTransitions[status]) == 0
+}
+
+// Move finished orders older than archiveAfterDays into the archive. The
+// archive is written before orders.json, so a crash in between can only
+// leave an order in both files, never in neither.
+func archiveOldOrders(now time.Time) (int, error) {
+	cutoff := now.AddDate(0, 0, -archiveAfterDays)
+
+	ordersMu.Lock()
+	var moved []Order
+	kept := orders[:0:0]
+	for _, o := range orders {
+		if terminalStatus(o.Status) && o.CreatedAt.Before(cutoff) {
+			moved = append(moved, copyOrder(o))
+		} else {
+			kept = append(kept, o)
+		}
+	}
+	if len(moved) == 0 {
+		ordersMu.Unlock()
+		return 0, nil
+	}
+
+	archiveMu.Lock()
+	seen := make(map[int]bool, len(archived))
+	for _, o := range archived {
+		seen[o.ID] = true
+	}
+	next := append([]Order(nil), archived...)
+	for _, o := range moved {
+		if !seen[o.ID] {
+			next = append(next, o)
+		}
+	}
+	data, err := json.MarshalIndent(next, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(archiveFile, data)
+	}
+	if err != nil {
+		archiveMu.Unlock()
+		ordersMu.Unlock()
+		return 0, err
+	}
+	archived = next
+	archiveMu.Unlock()
+
+	orders = kept
+	rebuildUsernameIndex()
+	touchOrders()
+	ordersMu.Unlock()
+
+	persistOrders()
+	return len(moved), nil
+}
+
+// Background archival loop, runs once at startup and then every archiveInterval
+func runArchiver() {
+	for {
+		n, err := archiveOldOrders(time.Now().UTC())
+		if err != nil {
+			log.Println("Failed to archive orders:", err)
+		} else if n > 0 {
+			log.Printf("Archived %d orders older than %d days", n, archiveAfterDays)
+		}
+		time.Sleep(archiveInterval)
+	}
+}
+
+// Query archived orders (GET /api/admin/archive?username=&status=&from=&to=&limit=&offset=), newest first
+func archiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	username := normalizeUsername(r.URL.Query().Get("username"))
+	status := r.URL.Query().Get("status")
+	if _, ok := allowedTransitions[status]; status != "" && !ok {
+		writeJSONError(w, http.StatusBadRequest, "unknown status")
+		return
+	}
+	from, err := queryTime(r, "from")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid from: must be RFC3339")
+		return
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid to: must be RFC3339")
+		return
+	}
+
+	result := []Order{}
+	archiveMu.Lock()
+	for _, o := range archived {
+		if username != "" && normalizeUsername(o.Username) != username {
+			continue
+		}
+		if status != "" && o.Status != status {
+			continue
+		}
+		if !from.IsZero() && o.CreatedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !o.CreatedAt.Before(to) {
+			continue
+		}
+		c := copyOrder(o)
+		if c.Items == nil {
+			c.Items = []Product{}
+		}
+		result = append(result, c)
+	}
+	archiveMu.Unlock()
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+
+	total := len(result)
+	offset, limit := orderPageParams(r)
+	result = paginate(result, offset, limit)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	writeJSON(w, http.StatusOK, result, wantPretty(r))
+}
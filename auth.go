@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Admin bearer token from ADMIN_TOKEN (read in main), admin is disabled when empty
+var adminToken string
+
+// Basic auth credentials from ADMIN_USER/ADMIN_PASS, disabled unless both are set
+var adminUser, adminPass string
+
+// Check admin credentials: 0 when ok, else 401 (missing) or 403 (wrong).
+// Either a bearer token or Basic credentials will do; a wrong Basic login is
+// a 401 so browsers prompt again.
+func checkAdmin(r *http.Request) int {
+	if user, pass, ok := r.BasicAuth(); ok {
+		if adminUser == "" || adminPass == "" {
+			return http.StatusForbidden
+		}
+		// Compare both so timing doesn't reveal which one was wrong
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(adminUser))
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(adminPass))
+		if userOK&passOK != 1 {
+			return http.StatusUnauthorized
+		}
+		return 0
+	}
+
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return http.StatusUnauthorized
+	}
+	if adminToken == "" || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(adminToken)) != 1 {
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// True when the request carries valid admin credentials
+func isAdmin(r *http.Request) bool {
+	return checkAdmin(r) == 0
+}
+
+// Who an admin request came from, for audit logs
+func adminIdentity(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return "user=" + user
+	}
+	return "token"
+}
+
+// Write the 401/403 for a non-admin request, true when it was rejected
+func denyNonAdmin(w http.ResponseWriter, r *http.Request) bool {
+	switch checkAdmin(r) {
+	case http.StatusUnauthorized:
+		if adminUser != "" && adminPass != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="zone_out admin", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zone_out admin"`)
+		}
+		writeJSONError(w, http.StatusUnauthorized, "admin credentials required")
+		return true
+	case http.StatusForbidden:
+		writeJSONError(w, http.StatusForbidden, "invalid admin credentials")
+		return true
+	}
+	return false
+}
+
+// Guard a handler behind the admin token or Basic credentials
+func requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if denyNonAdmin(w, r) {
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Product category backed by a folder under imagesDir
+type Category struct {
+	Slug   string `json:"route"`  // API path segment, e.g. "stickers"
+	Folder string `json:"folder"` // Folder name under images/, also used in image URLs
+	Name   string `json:"name"`   // Display name for the storefront
+}
+
+// Optional override for the built-in list, read at startup and again on reload (admin API or SIGHUP)
+const categoriesFile = "categories.json"
+
+// Built-in categories, used whenever categoriesFile doesn't exist
+var builtinCategories = []Category{
+	{Slug: "keychains", Folder: "Keychains", Name: "Keychains"},
+	{Slug: "stickers", Folder: "Stickers", Name: "Stickers"},
+	{Slug: "pocketwatch", Folder: "PocketWatch", Name: "Pocket Watch"},
+	{Slug: "bracelet", Folder: "Bracelet", Name: "Bracelet"},
+	{Slug: "lockets", Folder: "Lockets", Name: "Lockets"},
+	{Slug: "posters", Folder: "Posters", Name: "Posters"},
+	{Slug: "anime", Folder: "Anime", Name: "Anime"},
+	{Slug: "polaroids", Folder: "Polaroids", Name: "Polaroids"},
+	{Slug: "albums", Folder: "Albums", Name: "Albums"},
+}
+
+// Active categories. The slice is swapped whole under categoriesMu and never
+// mutated, read it via currentCategories.
+var (
+	categories   = builtinCategories
+	categoriesMu sync.RWMutex
+)
+
+// Routes must be simple path segments
+var validRoute = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Legacy /api/{route} paths that belong to other handlers
+var reservedRoutes = map[string]bool{
+	"admin": true, "categories": true, "category": true, "orders": true, "search": true,
+}
+
+// Load [{"folder":"Mugs","name":"Mugs","route":"mugs"}, ...] from path,
+// a missing file means the built-in list
+func loadCategories(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		categoriesMu.Lock()
+		categories = builtinCategories
+		categoriesMu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var loaded []Category
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+	if len(loaded) == 0 {
+		return errors.New("no categories defined")
+	}
+
+	routes, folders := map[string]bool{}, map[string]bool{}
+	for i := range loaded {
+		c := &loaded[i]
+		c.Slug = strings.ToLower(strings.TrimSpace(c.Slug))
+		c.Folder = strings.TrimSpace(c.Folder)
+		c.Name = strings.TrimSpace(c.Name)
+		switch {
+		case !validRoute.MatchString(c.Slug):
+			return fmt.Errorf("category %d: invalid route %q", i, c.Slug)
+		case reservedRoutes[c.Slug]:
+			return fmt.Errorf("category %d: route %q is reserved", i, c.Slug)
+		case c.Folder == "" || c.Folder != filepath.Base(c.Folder) || strings.HasPrefix(c.Folder, "."):
+			return fmt.Errorf("category %d: invalid folder %q", i, c.Folder)
+		case routes[c.Slug]:
+			return fmt.Errorf("category %d: duplicate route %q", i, c.Slug)
+		case folders[c.Folder]:
+			return fmt.Errorf("category %d: duplicate folder %q", i, c.Folder)
+		}
+		if c.Name == "" {
+			c.Name = c.Folder
+		}
+		routes[c.Slug], folders[c.Folder] = true, true
+	}
+
+	categoriesMu.Lock()
+	categories = loaded
+	categoriesMu.Unlock()
+	return nil
+}
+
+// Snapshot of the active category list
+func currentCategories() []Category {
+	categoriesMu.RLock()
+	defer categoriesMu.RUnlock()
+	return categories
+}
+
+// Look up a category by its slug (case-insensitive)
+func findCategory(slug string) (Category, bool) {
+	slug = strings.ToLower(slug)
+	for _, c := range currentCategories() {
+		if c.Slug == slug {
+			return c, true
+		}
+	}
+	return Category{}, false
+}
+
+// Folder path on disk for a category
+func (c Category) Dir() string {
+	return filepath.Join(imagesDir, c.Folder)
+}
+
+// Legacy per-category routes like /api/stickers, resolved per request so
+// categories added by a reload work without re-registering handlers
+func legacyCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimPrefix(r.URL.Path, "/api/")
+	c, ok := findCategory(slug)
+	if !ok || strings.Contains(slug, "/") {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	serveCategory(w, r, c)
+}
+
+// List a category's images
+func serveCategory(w http.ResponseWriter, r *http.Request, c Category) {
+	serveImagesFromFolder(w, r, c.Dir(), c.Folder)
+}
+
+// Generic category handler (GET /api/category/{name}, POST .../upload, DELETE .../{file})
+func categoryHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/category/")
+	slug, action, _ := strings.Cut(rest, "/")
+	c, ok := findCategory(slug)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "category not found")
+		return
+	}
+
+	switch action {
+	case "":
+		serveCategory(w, r, c)
+	case "upload":
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			uploadImagesHandler(w, r, c)
+		})(w, r)
+	default:
+		// DELETE /api/category/{name}/{file}
+		if r.Method != http.MethodDelete {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			deleteImageHandler(w, r, c, action)
+		})(w, r)
+	}
+}
+
+// Search limits for /api/search
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+// Search filenames across all categories (GET /api/search?q=&limit=)
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	if q == "" {
+		writeJSONError(w, http.StatusBadRequest, "q required")
+		return
+	}
+
+	limit := queryInt(r, "limit", defaultSearchLimit)
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	baseURL := requestBaseURL(r)
+	results := []Product{}
+	for _, c := range currentCategories() {
+		if len(results) >= limit {
+			break
+		}
+		files, err := readImageDir(c.Dir())
+		if err != nil {
+			continue // Missing folder just has no matches
+		}
+		// Build the full listing so IDs match the category endpoint
+		products := folderProducts(baseURL, c.Folder, files)
+		for i, f := range files {
+			if !strings.Contains(strings.ToLower(f.Name), q) {
+				continue
+			}
+			p := products[i]
+			p.Category = c.Folder
+			results = append(results, p)
+			if len(results) >= limit {
+				break
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, results, wantPretty(r))
+}
+
+// Summary of a category that has images on disk
+type categoryInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Folder      string `json:"folder"`
+	Count       int    `json:"count"`
+	SampleURL   string `json:"sample_url"`
+}
+
+// Categories with at least one image (GET /api/categories)
+func categoriesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, categorySummaries(requestBaseURL(r)), wantPretty(r))
+}
+
+// Homepage covers, first image of each non-empty category (GET /api/categories/covers)
+func categoryCoversHandler(w http.ResponseWriter, r *http.Request) {
+	type cover struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+		CoverURL    string `json:"cover_url"`
+		Count       int    `json:"count"`
+	}
+
+	covers := []cover{}
+	for _, c := range categorySummaries(requestBaseURL(r)) {
+		covers = append(covers, cover{Name: c.Name, DisplayName: c.DisplayName, CoverURL: c.SampleURL, Count: c.Count})
+	}
+
+	writeJSON(w, http.StatusOK, covers, wantPretty(r))
+}
+
+// Summaries of categories that exist on disk and have images
+func categorySummaries(baseURL string) []categoryInfo {
+	result := []categoryInfo{}
+	for _, c := range currentCategories() {
+		files, err := readImageDir(c.Dir())
+		if err != nil || len(files) == 0 {
+			continue // Missing or empty folders aren't shown
+		}
+		result = append(result, categoryInfo{
+			Name:        c.Slug,
+			DisplayName: c.Name,
+			Folder:      c.Folder,
+			Count:       len(files),
+			SampleURL:   folderProducts(baseURL, c.Folder, files[:1])[0].URL,
+		})
+	}
+	return result
+}
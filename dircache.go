@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a directory listing is reused before re-reading from disk
+const dirCacheTTL = 60 * time.Second
+
+// Listable image extensions and their content types
+var imageExts = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".avif": "image/avif",
+}
+
+// An image file found in a category folder
+type imageFile struct {
+	Name        string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+type dirCacheEntry struct {
+	files    []imageFile
+	modTime  time.Time // Directory mtime when read, changes on add/remove
+	loadedAt time.Time
+}
+
+var (
+	dirCache   = map[string]dirCacheEntry{}
+	dirCacheMu sync.Mutex
+)
+
+// List files in folder sorted by name, served from cache while fresh
+func readImageDir(folder string) ([]imageFile, error) {
+	info, err := os.Stat(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	dirCacheMu.Lock()
+	entry, ok := dirCache[folder]
+	dirCacheMu.Unlock()
+	if ok && time.Since(entry.loadedAt) < dirCacheTTL && entry.modTime.Equal(info.ModTime()) {
+		return entry.files, nil
+	}
+
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []imageFile{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		// Only images, so stray files like .DS_Store never become products
+		contentType, ok := imageExts[strings.ToLower(filepath.Ext(e.Name()))]
+		if !ok {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(folder, e.Name()))
+		if err != nil {
+			continue
+		}
+		files = append(files, imageFile{
+			Name:        e.Name(),
+			Size:        fi.Size(),
+			ModTime:     fi.ModTime().UTC(),
+			ContentType: contentType,
+		})
+	}
+	// Sort by name explicitly so IDs and pages stay stable across requests
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	dirCacheMu.Lock()
+	dirCache[folder] = dirCacheEntry{files: files, modTime: info.ModTime(), loadedAt: time.Now()}
+	dirCacheMu.Unlock()
+	return files, nil
+}
+
+// Drop a cached listing so the next read goes to disk
+func bustDirCache(folder string) {
+	dirCacheMu.Lock()
+	delete(dirCache, folder)
+	dirCacheMu.Unlock()
+}
+
+// Forget every cached listing, returns how many were dropped
+func clearDirCache() int {
+	dirCacheMu.Lock()
+	defer dirCacheMu.Unlock()
+	n := len(dirCache)
+	dirCache = map[string]dirCacheEntry{}
+	return n
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// SMTP settings from SMTP_HOST/PORT/USER/PASS/FROM (read in main), sending is
+// skipped unless host and from are set
+type smtpConfig struct {
+	Host, Port, User, Pass, From string
+}
+
+var smtpSettings smtpConfig
+
+func loadSMTPConfig() smtpConfig {
+	c := smtpConfig{
+		Host: os.Getenv("SMTP_HOST"),
+		Port: os.Getenv("SMTP_PORT"),
+		User: os.Getenv("SMTP_USER"),
+		Pass: os.Getenv("SMTP_PASS"),
+		From: os.Getenv("SMTP_FROM"),
+	}
+	if c.Port == "" {
+		c.Port = "587"
+	}
+	return c
+}
+
+func (c smtpConfig) enabled() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// Basic address check, a bare "user@domain" with no display name
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@")+1:], ".") {
+		return errors.New("invalid email")
+	}
+	return nil
+}
+
+// Email an order confirmation in the background when SMTP is configured
+func sendOrderConfirmation(o Order) {
+	if o.Email == "" || !smtpSettings.enabled() {
+		return
+	}
+
+	go func() {
+		if err := sendMail(smtpSettings, o.Email, fmt.Sprintf("Order #%d confirmed", o.ID), confirmationBody(o)); err != nil {
+			log.Printf("Confirmation email for order %d failed: %v", o.ID, err)
+		}
+	}()
+}
+
+func confirmationBody(o Order) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\r\n\r\nThanks for your order #%d placed on %s.\r\n\r\n",
+		o.Username, o.ID, o.CreatedAt.Format("02 Jan 2006 15:04 MST"))
+	for _, p := range o.Items {
+		fmt.Fprintf(&b, "- %s x%d  %.2f %s\r\n", p.URL, max(p.Quantity, 1), p.Price, o.Currency)
+	}
+	fmt.Fprintf(&b, "\r\nTotal: %.2f %s\r\n", o.Total, o.Currency)
+	return b.String()
+}
+
+func sendMail(c smtpConfig, to, subject, body string) error {
+	var auth smtp.Auth
+	if c.User != "" {
+		auth = smtp.PlainAuth("", c.User, c.Pass, c.Host)
+	}
+	msg := "From: " + c.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(net.JoinHostPort(c.Host, c.Port), auth, c.From, []string{to}, []byte(msg))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Responses smaller than this are sent uncompressed, gzip overhead isn't worth it
+const gzipMinSize = 1024
+
+var gzipPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// Buffers the start of a response and only compresses once it reaches gzipMinSize
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         []byte
+	gz          *gzip.Writer
+	passthrough bool // Decided not to compress, write straight through
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	if g.passthrough {
+		return g.ResponseWriter.Write(b)
+	}
+
+	// Handler already encoded its body
+	if g.Header().Get("Content-Encoding") != "" {
+		g.startPassthrough()
+		return g.ResponseWriter.Write(b)
+	}
+
+	g.buf = append(g.buf, b...)
+	if len(g.buf) >= gzipMinSize {
+		if err := g.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (g *gzipResponseWriter) startGzip() error {
+	h := g.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Add("Vary", "Accept-Encoding")
+	h.Del("Content-Length")
+	g.ResponseWriter.WriteHeader(g.status)
+
+	g.gz = gzipPool.Get().(*gzip.Writer)
+	g.gz.Reset(g.ResponseWriter)
+	_, err := g.gz.Write(g.buf)
+	g.buf = nil
+	return err
+}
+
+func (g *gzipResponseWriter) startPassthrough() {
+	g.passthrough = true
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	if len(g.buf) > 0 {
+		g.ResponseWriter.Write(g.buf)
+		g.buf = nil
+	}
+}
+
+// Flush whatever is buffered (streaming handlers), compressing if already started
+func (g *gzipResponseWriter) Flush() {
+	switch {
+	case g.gz != nil:
+		g.gz.Flush()
+	case !g.passthrough:
+		g.startPassthrough()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Finish the response, small bodies go out as-is
+func (g *gzipResponseWriter) close() {
+	if g.gz != nil {
+		g.gz.Close()
+		gzipPool.Put(g.gz)
+		g.gz = nil
+		return
+	}
+	if !g.passthrough {
+		g.startPassthrough()
+	}
+}
+
+// Drop a response that hasn't gone out yet without writing a header, so a
+// panic further up can still send its own status
+func (g *gzipResponseWriter) discard() {
+	if g.gz != nil {
+		g.gz.Close()
+		gzipPool.Put(g.gz)
+		g.gz = nil
+	}
+	g.buf = nil
+}
+
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// Gzip JSON API responses when the client accepts it, images are already compressed
+func withGzip(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead ||
+			strings.HasPrefix(r.URL.Path, "/images/") ||
+			!strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer func() {
+			if err := recover(); err != nil {
+				gw.discard()
+				panic(err) // withRecover still has to write the 500
+			}
+			gw.close()
+		}()
+		h.ServeHTTP(gw, r)
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import "time"
+
+// How long an Idempotency-Key keeps pointing at the order it created
+const idempotencyTTL = 24 * time.Hour
+
+type idempotencyEntry struct {
+	orderID int
+	expires time.Time
+}
+
+// Idempotency-Key (scoped per username) -> created order, guarded by ordersMu
+var (
+	idempotencyKeys      = map[string]idempotencyEntry{}
+	idempotencyLastSweep time.Time
+)
+
+func idempotencyMapKey(username, key string) string {
+	return username + "\x00" + key
+}
+
+// Order index a key already created, -1 if none (caller must hold ordersMu)
+func lookupIdempotencyKey(username, key string, now time.Time) int {
+	e, ok := idempotencyKeys[idempotencyMapKey(username, key)]
+	if !ok || now.After(e.expires) {
+		return -1
+	}
+	return findOrderIndex(e.orderID)
+}
+
+// Remember which order a key created (caller must hold ordersMu)
+func storeIdempotencyKey(username, key string, orderID int, now time.Time) {
+	// Expired keys are swept at most once a minute to bound memory
+	if now.Sub(idempotencyLastSweep) > time.Minute {
+		for k, e := range idempotencyKeys {
+			if now.After(e.expires) {
+				delete(idempotencyKeys, k)
+			}
+		}
+		idempotencyLastSweep = now
+	}
+	idempotencyKeys[idempotencyMapKey(username, key)] = idempotencyEntry{orderID: orderID, expires: now.Add(idempotencyTTL)}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "slices"
+
+// Normalized username -> positions in orders, guarded by ordersMu.
+// Lets customer lookups touch only their own orders instead of scanning all.
+var ordersByUser = map[string][]int{}
+
+// Rebuild the whole index, needed after loading or splicing orders (caller must hold ordersMu)
+func rebuildUsernameIndex() {
+	ordersByUser = make(map[string][]int, len(ordersByUser))
+	for i := range orders {
+		indexOrder(i)
+	}
+}
+
+// Add orders[idx] to the index (caller must hold ordersMu)
+func indexOrder(idx int) {
+	u := normalizeUsername(orders[idx].Username)
+	ordersByUser[u] = append(ordersByUser[u], idx)
+}
+
+// Move orders[idx] after its username changed (caller must hold ordersMu)
+func reindexOrder(idx int, oldUsername string) {
+	old := normalizeUsername(oldUsername)
+	if old == normalizeUsername(orders[idx].Username) {
+		return
+	}
+
+	ordersByUser[old] = slices.DeleteFunc(ordersByUser[old], func(i int) bool { return i == idx })
+	if len(ordersByUser[old]) == 0 {
+		delete(ordersByUser, old)
+	}
+
+	// Keep positions ascending so results stay in insertion order
+	u := normalizeUsername(orders[idx].Username)
+	pos, _ := slices.BinarySearch(ordersByUser[u], idx)
+	ordersByUser[u] = slices.Insert(ordersByUser[u], pos, idx)
+}
@@ -1,192 +1,1695 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
 	"log"
+	"math"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 type Product struct {
-	ID  int    `json:"id"`
-	URL string `json:"url"`
+	ID          int       `json:"id" xml:"id"`
+	URL         string    `json:"url" xml:"url"`
+	Price       float64   `json:"price" xml:"price"`
+	Quantity    int       `json:"quantity,omitempty" xml:"quantity,omitempty"` // Order items only, 0/omitted means 1
+	Subtotal    float64   `json:"subtotal,omitempty" xml:"subtotal,omitempty"` // Order items only, price x quantity set by the server
+	SizeBytes   int64     `json:"size_bytes,omitempty" xml:"size_bytes,omitempty"`
+	ModifiedAt  time.Time `json:"modified_at,omitzero" xml:"modified_at"`
+	ContentType string    `json:"content_type,omitempty" xml:"content_type,omitempty"`
+	Category    string    `json:"category,omitempty" xml:"category,omitempty"`
+	Available   *bool     `json:"available,omitempty" xml:"available,omitempty"` // Listings only, false when in out_of_stock.json
 }
 
 type Order struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Items     []Product `json:"items"`
-	CreatedAt time.Time `json:"created_at"`
-	Hidden    bool      `json:"hidden"`
+	ID        int       `json:"id" xml:"id"`
+	Username  string    `json:"username" xml:"username"`
+	Email     string    `json:"email,omitempty" xml:"email,omitempty"` // Optional, for confirmations
+	Items     []Product `json:"items" xml:"items>item"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	Hidden    bool      `json:"hidden" xml:"hidden"`
+	Status    string    `json:"status" xml:"status"`
+	Total     float64   `json:"total" xml:"total"`
+	Currency  string    `json:"currency" xml:"currency"` // ISO 4217, defaults to defaultCurrency
+
+	CancelledAt time.Time `json:"cancelled_at,omitzero" xml:"cancelled_at"`
+
+	// Soft delete, kept for audit history until purged
+	Deleted   bool      `json:"deleted,omitempty" xml:"deleted,omitempty"`
+	DeletedAt time.Time `json:"deleted_at,omitzero" xml:"deleted_at"`
+
+	// Staff annotations, only ever shown to admins
+	Notes []OrderNote `json:"notes,omitempty" xml:"notes>note"`
+
+	// Marketing labels like "vip", admin-only like notes
+	Tags []string `json:"tags,omitempty" xml:"tags>tag"`
+}
+
+type OrderNote struct {
+	Author    string    `json:"author" xml:"author"`
+	Text      string    `json:"text" xml:"text"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+}
+
+// encoding/xml has no omitzero, so unset times become nil pointers that omitempty drops
+func xmlTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (p Product) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type plain Product
+	return e.EncodeElement(struct {
+		plain
+		ModifiedAt *time.Time `xml:"modified_at,omitempty"`
+	}{plain(p), xmlTime(p.ModifiedAt)}, start)
+}
+
+func (o Order) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type plain Order
+	type notes struct {
+		Note []OrderNote `xml:"note"`
+	}
+	type tags struct {
+		Tag []string `xml:"tag"`
+	}
+	v := struct {
+		plain
+		CancelledAt *time.Time `xml:"cancelled_at,omitempty"`
+		DeletedAt   *time.Time `xml:"deleted_at,omitempty"`
+		Notes       *notes     `xml:"notes,omitempty"` // a>b paths always emit the parent
+		Tags        *tags      `xml:"tags,omitempty"`
+	}{plain: plain(o), CancelledAt: xmlTime(o.CancelledAt), DeletedAt: xmlTime(o.DeletedAt)}
+	if len(o.Notes) > 0 {
+		v.Notes = &notes{o.Notes}
+	}
+	if len(o.Tags) > 0 {
+		v.Tags = &tags{o.Tags}
+	}
+	return e.EncodeElement(v, start)
+}
+
+// XML document root for order lists
+type orderListXML struct {
+	XMLName xml.Name `xml:"orders"`
+	Orders  []Order  `xml:"order"`
+}
+
+// XML only when application/xml or text/xml is the client's single top
+// q-value choice. Ties, wildcards, q=0 and browser-style headers (which rank
+// text/html first) all get JSON.
+func wantsXML(r *http.Request) bool {
+	bestXML, bestOther := 0.0, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, _ := strings.Cut(part, ";")
+		mt = strings.TrimSpace(strings.ToLower(mt))
+		if mt == "" {
+			continue
+		}
+		q := acceptQ(params)
+		if mt == "application/xml" || mt == "text/xml" {
+			bestXML = max(bestXML, q)
+		} else {
+			bestOther = max(bestOther, q)
+		}
+	}
+	return bestXML > 0 && bestXML > bestOther
+}
+
+// q parameter of one Accept entry, 1 when absent, 0 when malformed
+func acceptQ(params string) float64 {
+	for _, p := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok || strings.ToLower(strings.TrimSpace(k)) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 0
+		}
+		return q
+	}
+	return 1
+}
+
+// Write v as an XML response with the given status
+func writeXML(w http.ResponseWriter, status int, v any, pretty bool) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if pretty {
+		enc.Indent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		log.Printf("encode xml response: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to encode response")
+		return
+	}
+	buf.WriteByte('\n')
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// Order fulfillment statuses
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusShipped   = "shipped"
+	StatusDelivered = "delivered"
+	StatusCancelled = "cancelled"
+)
+
+// Allowed status changes, keyed by current status
+var allowedTransitions = map[string][]string{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusShipped, StatusCancelled},
+	StatusShipped:   {StatusDelivered},
+	StatusDelivered: {},
+	StatusCancelled: {},
+}
+
+var (
+	orders   = []Order{}
+	ordersMu sync.Mutex
+
+	// Last issued order ID, only ever touched through nextID
+	lastOrderID atomic.Int64
+)
+
+// Allocate a unique order ID, safe with or without ordersMu held
+func nextID() int {
+	return int(lastOrderID.Add(1))
+}
+
+// Write {"error":message,"status":code} so clients have one error shape
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, status, map[string]any{
+		"error":  message,
+		"status": status,
+	}, false)
+}
+
+// ?pretty=true asks for indented JSON, handy with curl
+func wantPretty(r *http.Request) bool {
+	return r.URL.Query().Get("pretty") == "true"
+}
+
+// Encode v as JSON, two-space indented when pretty, always newline-terminated
+func encodeJSON(v any, pretty bool) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any, pretty bool) {
+	body, err := encodeJSON(v, pretty)
+	if err != nil {
+		log.Printf("encode response: %v", err)
+		status, body = http.StatusInternalServerError, []byte(`{"error":"failed to encode response","status":500}`+"\n")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Supported ?sort= values for the orders list
+var orderSorts = map[string]func(a, b Order) bool{
+	"created_asc":  func(a, b Order) bool { return a.CreatedAt.Before(b.CreatedAt) },
+	"created_desc": func(a, b Order) bool { return a.CreatedAt.After(b.CreatedAt) },
+	"id_desc":      func(a, b Order) bool { return a.ID > b.ID },
+}
+
+// 413 when the body hit the size limit, else 400 with msg
+func writeBodyError(w http.ResponseWriter, err error, msg string) {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body too large: max %d bytes", tooBig.Limit))
+		return
+	}
+	writeJSONError(w, http.StatusBadRequest, msg)
+}
+
+// Orders list pagination
+const (
+	defaultOrdersLimit = 50
+	maxOrdersLimit     = 200
+)
+
+// Image listing pagination, per_page is clamped to maxImagesPerPage (MAX_PER_PAGE)
+const defaultImagesPerPage = 24
+
+var maxImagesPerPage = 100
+
+// offset/limit for order lists, defaulted and capped at maxOrdersLimit
+func orderPageParams(r *http.Request) (offset, limit int) {
+	limit = queryInt(r, "limit", defaultOrdersLimit)
+	if limit == 0 {
+		limit = defaultOrdersLimit
+	}
+	return queryInt(r, "offset", 0), min(limit, maxOrdersLimit)
+}
+
+// Read a non-negative int query param, falling back to def when missing/invalid
+func queryInt(r *http.Request, key string, def int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+// Read an optional RFC3339 query param, zero time when missing
+func queryTime(r *http.Request, key string) (time.Time, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// Slice window [offset, offset+limit) clamped to the slice bounds
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset < 0 || offset > len(items) {
+		offset = len(items)
+	}
+	if limit < 0 || limit > len(items)-offset {
+		limit = len(items) - offset
+	}
+	return items[offset : offset+limit]
+}
+
+// Allowed CORS origins from ALLOWED_ORIGINS (comma-separated), empty means "*"
+var allowedOrigins []string
+
+// Seconds a preflight may be cached, from CORS_MAX_AGE (set in main)
+var corsMaxAge = 600
+
+// Response headers the frontend may read (a "*" is not honoured with credentials)
+const exposedHeaders = "X-Total-Count, X-Total-Pages, X-Item-Count, Retry-After, ETag, X-Request-ID, Last-Modified"
+
+// Parse a comma-separated env list, dropping blanks
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Check the request Origin against allowedOrigins
+func originAllowed(origin string) bool {
+	for _, o := range allowedOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// Full CORS middleware for Flutter
+func withCORS(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setCORS := true
+		if len(allowedOrigins) == 0 {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Expose-Headers", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			if originAllowed(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+			} else {
+				setCORS = false
+			}
+		}
+		if setCORS {
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, Idempotency-Key")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		}
+		if r.Method == http.MethodOptions {
+			if allow := allowedMethods(r.URL.Path); allow != "" {
+				w.Header().Set("Allow", allow)
+			}
+			if setCORS {
+				// Browser caches the preflight instead of repeating it every call
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Methods each route accepts, for the Allow header on OPTIONS. "*" matches
+// one path segment, keep in sync when adding routes in main.
+var routeMethods = []struct {
+	pattern string
+	methods string
+}{
+	{"/", "GET, HEAD"},
+	{"/healthz", "GET, HEAD"},
+	{"/metrics", "GET, HEAD"},
+	{"/app-ads.txt", "GET, HEAD"},
+	{"/api/categories", "GET"},
+	{"/api/categories/covers", "GET"},
+	{"/api/search", "GET"},
+	{"/api/category/*", "GET, HEAD"},
+	{"/api/category/*/upload", "POST"},
+	{"/api/category/*/*", "DELETE"},
+	{"/api/orders", "GET, POST"},
+	{"/api/orders/validate", "POST"},
+	{"/api/orders/*", "GET, PUT, DELETE"},
+	{"/api/orders/*/status", "PATCH"},
+	{"/api/orders/*/cancel", "POST"},
+	{"/api/orders/*/reorder", "POST"},
+	{"/api/orders/*/notes", "POST"},
+	{"/api/orders/*/tags", "POST"},
+	{"/api/orders/*/receipt", "GET"},
+	{"/api/hideOrder", "POST"},
+	{"/api/unhideOrder", "POST"},
+	{"/api/admin/summary", "GET"},
+	{"/api/admin/orders/bulkDelete", "POST"},
+	{"/api/admin/orders/byProduct", "GET"},
+	{"/api/admin/orders/recent", "GET"},
+	{"/api/admin/orders/search", "GET"},
+	{"/api/admin/orders/byDay", "GET"},
+	{"/api/admin/orders/export.csv", "GET"},
+	{"/api/admin/orders/stream", "GET"},
+	{"/api/admin/orders/*", "DELETE"},
+	{"/api/admin/shutdown", "POST"},
+	{"/api/admin/images/duplicates", "GET"},
+	{"/api/admin/archive", "GET"},
+	{"/api/admin/reload", "POST"},
+}
+
+// Allow header value for path, "" for unknown routes. Exact routes win over
+// wildcards, legacy /api/{category} and /images/... are resolved directly.
+func allowedMethods(path string) string {
+	_, best := matchedRoute(path)
+	if best == "" {
+		if strings.HasPrefix(path, "/images/") {
+			best = "GET, HEAD"
+		} else if slug, ok := strings.CutPrefix(path, "/api/"); ok {
+			if _, found := findCategory(slug); found {
+				best = "GET, HEAD"
+			}
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return best + ", OPTIONS"
+}
+
+// Best routeMethods entry for path (fewest wildcards), empty when none match
+func matchedRoute(path string) (pattern, methods string) {
+	bestWild := -1
+	for _, rm := range routeMethods {
+		if wild, ok := matchRoute(rm.pattern, path); ok && (bestWild == -1 || wild < bestWild) {
+			pattern, methods, bestWild = rm.pattern, rm.methods, wild
+		}
+	}
+	return pattern, methods
+}
+
+// Match path against pattern segment by segment, reporting how many "*" were used
+func matchRoute(pattern, path string) (int, bool) {
+	ps, xs := strings.Split(pattern, "/"), strings.Split(path, "/")
+	if len(ps) != len(xs) {
+		return 0, false
+	}
+	wild := 0
+	for i := range ps {
+		switch {
+		case ps[i] == "*" && xs[i] != "":
+			wild++
+		case ps[i] != xs[i]:
+			return 0, false
+		}
+	}
+	return wild, true
+}
+
+// Root of the category folders, from IMAGES_DIR (set in main)
+var imagesDir string
+
+// Public base URL for image links, from PUBLIC_BASE_URL (read once in main)
+var publicBaseURL string
+
+// Base URL for links: PUBLIC_BASE_URL if set, otherwise derived from the request
+func requestBaseURL(r *http.Request) string {
+	if publicBaseURL != "" {
+		return publicBaseURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	// Render terminates TLS at its proxy
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme, _, _ = strings.Cut(proto, ",")
+		scheme = strings.TrimSpace(scheme)
+	}
+	return scheme + "://" + r.Host
+}
+
+// Serve images from folder (keep folder structure, encode file names)
+func serveImagesFromFolder(w http.ResponseWriter, r *http.Request, folder, route string) {
+	types, err := extFilter(r.URL.Query().Get("ext"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	files, err := readImageDir(folder)
+	if err != nil {
+		// Never echo the filesystem error, it carries the absolute path
+		if errors.Is(err, fs.ErrNotExist) {
+			writeJSONError(w, http.StatusNotFound, "category not found")
+			return
+		}
+		log.Printf("read images dir %s: %v", folder, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read category")
+		return
+	}
+
+	// ?ext=png,jpg keeps only those formats (jpg and jpeg are the same type)
+	if types != nil {
+		filtered := []imageFile{}
+		for _, f := range files {
+			if types[f.ContentType] {
+				filtered = append(filtered, f)
+			}
+		}
+		files = filtered
+	}
+
+	baseURL := requestBaseURL(r)
+
+	// Conditional GET, listing only changes when files do
+	etag := listingETag(baseURL, route, r.URL.RawQuery, files)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	products := folderProducts(baseURL, route, files)
+
+	// Pagination (page is 1-based)
+	total := len(products)
+	perPage := queryInt(r, "per_page", defaultImagesPerPage)
+	if perPage == 0 {
+		perPage = defaultImagesPerPage
+	}
+	perPage = min(perPage, maxImagesPerPage)
+	page := queryInt(r, "page", 1)
+	if page == 0 {
+		page = 1
+	}
+	totalPages := (total + perPage - 1) / perPage
+	products = paginate(products, (page-1)*perPage, perPage)
+
+	// Encode up front so HEAD can report the real Content-Length
+	// ?wrap=true adds the count alongside the items, bare array stays the default
+	var payload any = products
+	if r.URL.Query().Get("wrap") == "true" {
+		payload = map[string]any{"count": total, "items": products}
+	}
+
+	body, err := encodeJSON(payload, wantPretty(r))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to encode listing")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("X-Total-Pages", strconv.Itoa(totalPages))
+	w.Header().Set("X-Item-Count", strconv.Itoa(total))
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(body)
+}
+
+// Content types for an ext=png,jpg list, nil when empty. Only extensions in
+// imageExts are accepted.
+func extFilter(raw string) (map[string]bool, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	types := map[string]bool{}
+	for _, e := range strings.Split(raw, ",") {
+		e = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(e), "."))
+		ct, ok := imageExts["."+e]
+		if !ok {
+			return nil, fmt.Errorf("unsupported ext %q: use jpg, jpeg, png, gif, webp or avif", e)
+		}
+		types[ct] = true
+	}
+	return types, nil
+}
+
+// Weak ETag over everything that shapes a listing response
+func listingETag(baseURL, route, query string, files []imageFile) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%v\n%s\n", baseURL, route, query, priceFor(route), stockFingerprint(filepath.Join(imagesDir, route)))
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", f.Name, f.Size, f.ModTime.UnixNano())
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// Match an If-None-Match header (list or "*") against etag
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Product ID scheme: "hash" (stable per category+file) or "sequential" (legacy 1..n)
+var productIDScheme = "hash"
+
+// Stable product ID derived from category folder and filename
+func productID(route, name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(route) + "/" + name))
+	id := int(h.Sum32() & 0x7fffffff) // keep it positive and JS-safe
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+// Build listing products for files in a category folder
+func folderProducts(baseURL, route string, files []imageFile) []Product {
+	products := []Product{}
+	soldOut := outOfStock(filepath.Join(imagesDir, route))
+
+	for i, file := range files {
+		id := i + 1
+		if productIDScheme == "hash" {
+			id = productID(route, file.Name)
+		}
+		available := !soldOut[file.Name]
+		encodedName := url.PathEscape(file.Name) // Encode spaces/special chars
+		products = append(products, Product{
+			ID:          id,
+			URL:         baseURL + "/images/" + url.PathEscape(route) + "/" + encodedName,
+			Price:       priceFor(route),
+			SizeBytes:   file.Size,
+			ModifiedAt:  file.ModTime,
+			ContentType: file.ContentType,
+			Available:   &available,
+		})
+	}
+	return products
+}
+
+// API index for developers exploring the server (exact "/" only)
+func rootHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name": "zone_out",
+		"endpoints": map[string]string{
+			"/api/categories":        "categories with images",
+			"/api/category/{name}":   "products in a category",
+			"/api/search?q=":         "search products across categories",
+			"/api/orders":            "list (GET) or create (POST) orders",
+			"/api/orders/{id}":       "get, update or delete an order",
+			"/api/orders/validate":   "validate an order without saving",
+			"/images/{category}/...": "product images",
+			"/images/thumb/...":      "resized product images",
+			"/healthz":               "readiness check",
+			"/metrics":               "Prometheus metrics",
+		},
+	}, wantPretty(r))
+}
+
+// Set in main, used for uptime reporting
+var startTime time.Time
+
+// Readiness check for Render
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	// Soft-deleted orders don't count, same as /metrics and the admin summary
+	ordersMu.Lock()
+	count := 0
+	for _, o := range orders {
+		if !o.Deleted {
+			count++
+		}
+	}
+	ordersMu.Unlock()
+
+	// A Render disk that didn't attach shows up here, not as a crash
+	status, code := "ok", http.StatusOK
+	images := checkImagesDir()
+	if images != "ok" {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, map[string]any{
+		"status":         status,
+		"images":         images,
+		"orders":         count,
+		"uptime_seconds": int(time.Since(startTime).Seconds()),
+	}, wantPretty(r))
+}
+
+// "ok" when imagesDir is a readable directory, else a short reason (the full
+// error with its path only goes to the log)
+func checkImagesDir() string {
+	info, err := os.Stat(imagesDir)
+	if err == nil && !info.IsDir() {
+		return "images path is not a directory"
+	}
+	if err == nil {
+		var f *os.File
+		if f, err = os.Open(imagesDir); err == nil {
+			if _, err = f.Readdirnames(1); err == io.EOF {
+				err = nil // empty is still readable
+			}
+			f.Close()
+		}
+	}
+	if err == nil {
+		return "ok"
+	}
+
+	log.Println("healthz: images dir:", err)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "images directory missing"
+	case errors.Is(err, fs.ErrPermission):
+		return "images directory not readable"
+	default:
+		return "images directory unavailable"
+	}
 }
 
-var (
-	orders      = []Order{}
-	ordersMu    sync.Mutex
-	nextOrderID = 1
-)
+// Hide order (admin only)
+func hideOrderHandler(w http.ResponseWriter, r *http.Request) {
+	setOrderHidden(w, r, true)
+}
+
+// Unhide a previously hidden order (admin only)
+func unhideOrderHandler(w http.ResponseWriter, r *http.Request) {
+	setOrderHidden(w, r, false)
+}
+
+// Shared by hide/unhide, responds with the updated order
+func setOrderHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// JSON body {"id": 5}, legacy ?id=5 still accepted for one release
+	var id int
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		n, err := strconv.Atoi(idStr)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad id")
+			return
+		}
+		id = n
+	} else {
+		var in struct {
+			ID int `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeBodyError(w, err, "invalid json")
+			return
+		}
+		if in.ID <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "bad id")
+			return
+		}
+		id = in.ID
+	}
+
+	ordersMu.Lock()
+	idx := findLiveOrderIndex(id)
+	if idx == -1 {
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	orders[idx].Hidden = hidden
+	updated := copyOrder(orders[idx])
+	touchOrders()
+	ordersMu.Unlock()
+
+	persistOrders()
+
+	writeJSON(w, http.StatusOK, updated, wantPretty(r))
+}
+
+// Orders handler
+func ordersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// Admins (token or Basic auth) see every order, customers only their own
+		admin := false
+		switch checkAdmin(r) {
+		case 0:
+			admin = true
+		case http.StatusForbidden:
+			writeJSONError(w, http.StatusForbidden, "invalid admin credentials")
+			return
+		}
+		username := normalizeUsername(r.URL.Query().Get("username"))
+		includeDeleted := admin && r.URL.Query().Get("includeDeleted") == "true"
+		excludeHidden := r.URL.Query().Get("excludeHidden") == "true"
+		tag := ""
+		if raw := strings.TrimSpace(r.URL.Query().Get("tag")); admin && raw != "" {
+			if tag = normalizeTag(raw); tag == "" {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid tag %q: must be 1-%d characters", raw, maxTagLen))
+				return
+			}
+		}
+
+		// Optional created_at window, from inclusive / to exclusive
+		from, err := queryTime(r, "from")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid from: must be RFC3339")
+			return
+		}
+		to, err := queryTime(r, "to")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid to: must be RFC3339")
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if _, ok := allowedTransitions[status]; status != "" && !ok {
+			writeJSONError(w, http.StatusBadRequest, "unknown status")
+			return
+		}
+
+		// Big-spender filter, total >= minTotal
+		minTotal := 0.0
+		if v := r.URL.Query().Get("minTotal"); v != "" {
+			minTotal, err = strconv.ParseFloat(v, 64)
+			if err != nil || minTotal < 0 || math.IsNaN(minTotal) || math.IsInf(minTotal, 0) {
+				writeJSONError(w, http.StatusBadRequest, "invalid minTotal: must be a non-negative number")
+				return
+			}
+		}
+
+		// Incremental polling, IDs only ever grow
+		afterID := 0
+		if v := r.URL.Query().Get("afterId"); v != "" {
+			afterID, err = strconv.Atoi(v)
+			if err != nil || afterID < 0 {
+				writeJSONError(w, http.StatusBadRequest, "invalid afterId: must be a non-negative integer")
+				return
+			}
+		}
+
+		sortBy := r.URL.Query().Get("sort")
+		if sortBy == "" {
+			sortBy = "created_desc"
+		}
+		less, ok := orderSorts[sortBy]
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, "unknown sort: use created_asc, created_desc or id_desc")
+			return
+		}
+
+		// Snapshot under the lock, sort and encode after releasing it so a
+		// slow client can't stall order writes
+		ordersMu.Lock()
+		modified, etag := ordersModified, ordersETag(ordersVersion)
+		if ordersNotModified(r, etag, modified) {
+			ordersMu.Unlock()
+			orderCacheHeaders(w, etag, modified)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		// Customers only visit their own orders through the username index
+		candidates := orders
+		if !admin {
+			candidates = make([]Order, 0, len(ordersByUser[username]))
+			for _, i := range ordersByUser[username] {
+				candidates = append(candidates, orders[i])
+			}
+		}
+
+		var result []Order
+		for _, o := range candidates {
+			if !from.IsZero() && o.CreatedAt.Before(from) {
+				continue
+			}
+			if !to.IsZero() && !o.CreatedAt.Before(to) {
+				continue
+			}
+			if status != "" && o.Status != status {
+				continue
+			}
+			if o.Total < minTotal {
+				continue
+			}
+			if o.ID <= afterID {
+				continue
+			}
+			if tag != "" && !slices.Contains(o.Tags, tag) {
+				continue
+			}
+			if o.Deleted && !includeDeleted {
+				continue
+			}
+			if o.Hidden && excludeHidden {
+				continue
+			}
+			if o.Hidden && !admin {
+				continue
+			}
+			// Own copy of Items so the response never shares the stored slice
+			c := viewFor(copyOrder(o), admin)
+			if c.Items == nil {
+				c.Items = []Product{}
+			}
+			result = append(result, c)
+		}
+		ordersMu.Unlock()
+
+		if result == nil {
+			result = []Order{}
+		}
+
+		sort.SliceStable(result, func(i, j int) bool { return less(result[i], result[j]) })
+
+		// Pagination window applied after filtering and sorting
+		total := len(result)
+		offset, limit := orderPageParams(r)
+		result = paginate(result, offset, limit)
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		orderCacheHeaders(w, etag, modified)
+		w.Header().Add("Vary", "Accept")
+		if wantsXML(r) {
+			writeXML(w, http.StatusOK, orderListXML{Orders: result}, wantPretty(r))
+			return
+		}
+		writeJSON(w, http.StatusOK, result, wantPretty(r))
+
+	case http.MethodPost:
+		var in Order
+		if err := decodeOrder(r, &in); err != nil {
+			writeBodyError(w, err, err.Error())
+			return
+		}
+
+		if err := prepareOrder(&in); err != nil {
+			writeOrderError(w, err)
+			return
+		}
+
+		// Retried requests with the same Idempotency-Key get the original order back
+		idemKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+		now := time.Now().UTC()
+
+		ordersMu.Lock()
+		if idemKey != "" {
+			if idx := lookupIdempotencyKey(in.Username, idemKey, now); idx != -1 {
+				existing := viewFor(copyOrder(orders[idx]), false)
+				ordersMu.Unlock()
+
+				writeJSON(w, http.StatusOK, existing, wantPretty(r))
+				return
+			}
+		}
+		insertOrder(&in, now)
+		if idemKey != "" {
+			storeIdempotencyKey(in.Username, idemKey, in.ID, now)
+		}
+		touchOrders()
+		ordersMu.Unlock()
+
+		persistOrders()
+		notifyOrderCreated(in)
+		sendOrderConfirmation(copyOrder(in))
+
+		writeJSON(w, http.StatusCreated, in, wantPretty(r))
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Get (owner or admin), update or delete (admin) order by ID, dispatch sub-resources like /status
+func orderByIDHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+	idStr, action, _ := strings.Cut(rest, "/")
+	// "/api/orders/" (or "//status") has no ID at all, say so instead of "bad id"
+	if idStr == "" {
+		writeJSONError(w, http.StatusNotFound, "missing order id: use /api/orders/{id}, or /api/orders to list")
+		return
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad id")
+		return
+	}
+
+	switch action {
+	case "":
+	case "status":
+		// Fulfillment is a staff action, customers use /cancel
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			orderStatusHandler(w, r, id)
+		})(w, r)
+		return
+	case "cancel":
+		cancelOrderHandler(w, r, id)
+		return
+	case "reorder":
+		reorderHandler(w, r, id)
+		return
+	case "receipt":
+		receiptHandler(w, r, id)
+		return
+	case "notes":
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			addOrderNoteHandler(w, r, id)
+		})(w, r)
+		return
+	case "tags":
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			orderTagsHandler(w, r, id)
+		})(w, r)
+		return
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		admin := isAdmin(r)
+		includeDeleted := admin && r.URL.Query().Get("includeDeleted") == "true"
+
+		username := normalizeUsername(r.URL.Query().Get("username"))
+
+		ordersMu.Lock()
+		idx := findOrderIndex(id)
+		// Customers only see their own orders, same rule as receipt, cancel and reorder
+		if idx == -1 || (!admin && (normalizeUsername(orders[idx].Username) != username || orders[idx].Hidden)) ||
+			(orders[idx].Deleted && !includeDeleted) {
+			ordersMu.Unlock()
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		o := viewFor(copyOrder(orders[idx]), admin)
+		ordersMu.Unlock()
+
+		if o.Items == nil {
+			o.Items = []Product{}
+		}
+
+		writeJSON(w, http.StatusOK, o, wantPretty(r))
+
+	case http.MethodPut:
+		// Rewriting an order (including its owner) is staff-only
+		if denyNonAdmin(w, r) {
+			return
+		}
+
+		var in Order
+		if err := decodeOrder(r, &in); err != nil {
+			writeBodyError(w, err, err.Error())
+			return
+		}
+
+		if err := prepareOrder(&in); err != nil {
+			writeOrderError(w, err)
+			return
+		}
+
+		ordersMu.Lock()
+		idx := findLiveOrderIndex(id)
+		if idx == -1 {
+			ordersMu.Unlock()
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+
+		// ID and CreatedAt always stay as originally stored
+		oldUsername := orders[idx].Username
+		orders[idx].Username = in.Username
+		reindexOrder(idx, oldUsername)
+		orders[idx].Items = in.Items
+		orders[idx].Total = in.Total
+		updated := viewFor(copyOrder(orders[idx]), true)
+		touchOrders()
+		ordersMu.Unlock()
 
-// Full CORS middleware for Flutter
-func withCORS(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Expose-Headers", "*")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
+		persistOrders()
+
+		writeJSON(w, http.StatusOK, updated, wantPretty(r))
+
+	case http.MethodDelete:
+		// Customers cancel instead, see /cancel
+		if denyNonAdmin(w, r) {
 			return
 		}
-		h.ServeHTTP(w, r)
-	})
+
+		ordersMu.Lock()
+		idx := findLiveOrderIndex(id)
+		if idx == -1 {
+			ordersMu.Unlock()
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+
+		// Soft delete, /api/admin/orders/{id} purges for real
+		orders[idx].Deleted = true
+		orders[idx].DeletedAt = time.Now().UTC()
+		touchOrders()
+		ordersMu.Unlock()
+
+		persistOrders()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
 }
 
-// Serve images from folder (keep folder structure, encode file names)
-func serveImagesFromFolder(w http.ResponseWriter, r *http.Request, folder, route string) {
-	files, err := os.ReadDir(folder)
-	if err != nil {
-		http.Error(w, "Failed to read images directory: "+err.Error(), http.StatusInternalServerError)
+// Change order status (PATCH /api/orders/{id}/status, admin only)
+func orderStatusHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPatch {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
-	baseURL := "https://zone-out-backend-server.onrender.com"
-	var products []Product
-	id := 1
+	var in struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeBodyError(w, err, "invalid json")
+		return
+	}
 
-	for _, file := range files {
-		if !file.IsDir() {
-			encodedName := url.PathEscape(file.Name()) // Encode spaces/special chars
-			products = append(products, Product{
-				ID:  id,
-				URL: baseURL + "/images/" + route + "/" + encodedName,
-			})
-			id++
-		}
+	if _, ok := allowedTransitions[in.Status]; !ok {
+		writeJSONError(w, http.StatusBadRequest, "unknown status")
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(products)
+	ordersMu.Lock()
+	idx := findLiveOrderIndex(id)
+	if idx == -1 {
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if !canTransition(orders[idx].Status, in.Status) {
+		from := orders[idx].Status
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusConflict, "cannot change status from "+from+" to "+in.Status)
+		return
+	}
+
+	orders[idx].Status = in.Status
+	if in.Status == StatusCancelled {
+		orders[idx].CancelledAt = time.Now().UTC()
+	}
+	updated := viewFor(copyOrder(orders[idx]), isAdmin(r))
+	touchOrders()
+	ordersMu.Unlock()
+
+	persistOrders()
+
+	writeJSON(w, http.StatusOK, updated, wantPretty(r))
 }
 
-// Hide order (admin only)
-func hideOrderHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	id, _ := strconv.Atoi(idStr)
+// Cancel an order (POST /api/orders/{id}/cancel?username=), keeps the record
+func cancelOrderHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	admin := isAdmin(r)
+	username := normalizeUsername(r.URL.Query().Get("username"))
 
 	ordersMu.Lock()
-	defer ordersMu.Unlock()
+	idx := findLiveOrderIndex(id)
+	// Customers may only cancel their own orders
+	if idx == -1 || (!admin && (normalizeUsername(orders[idx].Username) != username || orders[idx].Hidden)) {
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
 
-	for i := range orders {
-		if orders[i].ID == id {
-			orders[i].Hidden = true
-			break
-		}
+	if !canTransition(orders[idx].Status, StatusCancelled) {
+		from := orders[idx].Status
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusConflict, "cannot cancel a "+from+" order")
+		return
 	}
-	w.WriteHeader(http.StatusOK)
+
+	orders[idx].Status = StatusCancelled
+	orders[idx].CancelledAt = time.Now().UTC()
+	updated := viewFor(copyOrder(orders[idx]), admin)
+	touchOrders()
+	ordersMu.Unlock()
+
+	persistOrders()
+
+	writeJSON(w, http.StatusOK, updated, wantPretty(r))
 }
 
-// Orders handler
-func ordersHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		username := r.URL.Query().Get("username")
+// Clone an earlier order as a new pending one (POST /api/orders/{id}/reorder?username=)
+func reorderHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
 
-		ordersMu.Lock()
-		defer ordersMu.Unlock()
+	admin := isAdmin(r)
+	username := normalizeUsername(r.URL.Query().Get("username"))
 
-		var result []Order
-		for _, o := range orders {
-			if username == "admin" {
-				result = append(result, o)
-			} else if o.Username == username && !o.Hidden {
-				result = append(result, o)
-			}
-		}
+	ordersMu.Lock()
+	idx := findLiveOrderIndex(id)
+	// Customers may only clone their own orders
+	if idx == -1 || (!admin && (normalizeUsername(orders[idx].Username) != username || orders[idx].Hidden)) {
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	src := copyOrder(orders[idx])
+	ordersMu.Unlock()
 
-		if result == nil {
-			result = []Order{}
-		}
+	// Re-run validation so the clone gets today's prices, currency and limits
+	in := Order{Username: src.Username, Email: src.Email, Items: src.Items}
+	if err := prepareOrder(&in); err != nil {
+		writeOrderError(w, err)
+		return
+	}
 
-		for i := range result {
-			if result[i].Items == nil {
-				result[i].Items = []Product{}
-			}
-		}
+	ordersMu.Lock()
+	insertOrder(&in, time.Now().UTC())
+	touchOrders()
+	ordersMu.Unlock()
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(result)
+	persistOrders()
+	notifyOrderCreated(in)
+	sendOrderConfirmation(copyOrder(in))
 
-	case http.MethodPost:
-		var in Order
-		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+	writeJSON(w, http.StatusCreated, viewFor(in, admin), wantPretty(r))
+}
+
+// Append a staff note (POST /api/orders/{id}/notes, admin only)
+func addOrderNoteHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var in OrderNote
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeBodyError(w, err, "invalid json")
+		return
+	}
+	in.Text = strings.TrimSpace(in.Text)
+	if in.Text == "" {
+		writeJSONError(w, http.StatusBadRequest, "text required")
+		return
+	}
+	in.Author = strings.TrimSpace(in.Author)
+	if in.Author == "" {
+		in.Author = "admin"
+	}
+	in.CreatedAt = time.Now().UTC()
+
+	ordersMu.Lock()
+	idx := findLiveOrderIndex(id)
+	if idx == -1 {
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	orders[idx].Notes = append(orders[idx].Notes, in)
+	updated := copyOrder(orders[idx])
+	touchOrders()
+	ordersMu.Unlock()
+
+	persistOrders()
+
+	writeJSON(w, http.StatusCreated, updated, wantPretty(r))
+}
+
+// Longest tag and most tags one order can carry
+const (
+	maxTagLen       = 32
+	maxTagsPerOrder = 20
+)
+
+// Lowercased, trimmed tag, "" when unusable
+func normalizeTag(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if len(t) > maxTagLen {
+		return ""
+	}
+	return t
+}
+
+// Add and remove tags (POST /api/orders/{id}/tags {"add":["vip"],"remove":["giftwrap"]}, admin only)
+func orderTagsHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var in struct {
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeBodyError(w, err, "invalid json")
+		return
+	}
+	for _, t := range in.Add {
+		if normalizeTag(t) == "" {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid tag %q: must be 1-%d characters", t, maxTagLen))
 			return
 		}
+	}
 
-		if strings.TrimSpace(in.Username) == "" {
-			http.Error(w, "username required", http.StatusBadRequest)
-			return
+	remove := map[string]bool{}
+	for _, t := range in.Remove {
+		remove[normalizeTag(t)] = true
+	}
+
+	ordersMu.Lock()
+	idx := findLiveOrderIndex(id)
+	if idx == -1 {
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	// Existing tags first so order is stable, then new ones, deduped
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, t := range append(append([]string(nil), orders[idx].Tags...), in.Add...) {
+		t = normalizeTag(t)
+		if t == "" || seen[t] || remove[t] {
+			continue
 		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	if len(tags) > maxTagsPerOrder {
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("too many tags: max %d", maxTagsPerOrder))
+		return
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	orders[idx].Tags = tags
+	updated := copyOrder(orders[idx])
+	touchOrders()
+	ordersMu.Unlock()
+
+	persistOrders()
+
+	writeJSON(w, http.StatusOK, updated, wantPretty(r))
+}
+
+// Append in as a new pending order, caller must hold ordersMu. Server-owned
+// fields are reset so a client can't post an already hidden, cancelled or
+// deleted order.
+func insertOrder(in *Order, now time.Time) {
+	in.ID = nextID()
+	in.CreatedAt = now
+	in.Status = StatusPending
+	in.Notes = nil
+	in.Tags = nil
+	in.Hidden = false
+	in.Deleted = false
+	in.DeletedAt = time.Time{}
+	in.CancelledAt = time.Time{}
+	orders = append(orders, *in)
+	indexOrder(len(orders) - 1)
+}
 
-		if in.Items == nil {
-			in.Items = []Product{}
+// Check allowedTransitions for from -> to
+func canTransition(from, to string) bool {
+	for _, s := range allowedTransitions[from] {
+		if s == to {
+			return true
 		}
+	}
+	return false
+}
 
-		ordersMu.Lock()
-		in.ID = nextOrderID
-		nextOrderID++
-		in.CreatedAt = time.Now()
-		orders = append(orders, in)
-		ordersMu.Unlock()
+// Usernames match case-insensitively, "Alice " and "alice" are the same customer
+func normalizeUsername(u string) string {
+	return strings.ToLower(strings.TrimSpace(u))
+}
+
+// Max items in one order, from MAX_ORDER_ITEMS (set in main)
+var maxOrderItems = 50
+
+// Empty carts and oversized orders are rejected, "" when the count is fine
+func checkItemCount(n int) string {
+	if n == 0 {
+		return "order must contain at least one item"
+	}
+	if n > maxOrderItems {
+		return fmt.Sprintf("too many items: max %d per order", maxOrderItems)
+	}
+	return ""
+}
+
+// Validation failure for a single order item
+type itemError struct {
+	Index int // 0-based position in Items
+	Msg   string
+}
+
+func (e *itemError) Error() string {
+	return fmt.Sprintf("item %d: %s", e.Index, e.Msg)
+}
+
+// Reject blank URLs, non-positive IDs and duplicate IDs
+func validateItems(items []Product) *itemError {
+	seen := make(map[int]bool, len(items))
+	for i, p := range items {
+		if strings.TrimSpace(p.URL) == "" {
+			return &itemError{Index: i, Msg: "url required"}
+		}
+		if p.ID <= 0 {
+			return &itemError{Index: i, Msg: "id must be positive"}
+		}
+		if p.Quantity < 0 {
+			return &itemError{Index: i, Msg: "quantity must be positive"}
+		}
+		if seen[p.ID] {
+			return &itemError{Index: i, Msg: fmt.Sprintf("duplicate id %d", p.ID)}
+		}
+		seen[p.ID] = true
+	}
+	return nil
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(in)
+// Strictly decode an order body, errors are safe to show to the client
+func decodeOrder(r *http.Request, in *Order) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields() // Catch typos like "itmes" instead of storing an empty order
+	err := dec.Decode(in)
+	if err == nil {
+		return nil
+	}
 
+	var typeErr *json.UnmarshalTypeError
+	var tooBig *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooBig):
+		return err // writeBodyError turns this into a 413
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return errors.New("invalid json: " + strings.TrimPrefix(err.Error(), "json: "))
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("invalid json: field %q must be %s", typeErr.Field, typeErr.Type)
 	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return errors.New("invalid json")
 	}
 }
 
-// Delete order by ID
-func orderByIDHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/orders/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "bad id", http.StatusBadRequest)
+// Validate an incoming order and fill in server-side fields (item prices,
+// default quantities, total). Item problems come back as *itemError.
+func prepareOrder(in *Order) error {
+	in.Username = normalizeUsername(in.Username)
+	if in.Username == "" {
+		return errors.New("username required")
+	}
+
+	in.Email = strings.TrimSpace(in.Email)
+	if in.Email != "" {
+		if err := validateEmail(in.Email); err != nil {
+			return err
+		}
+	}
+
+	if in.Currency == "" {
+		in.Currency = defaultCurrency
+	}
+	if !validCurrency(in.Currency) {
+		return errors.New("invalid currency: must be a 3-letter uppercase ISO 4217 code")
+	}
+	// prices.json has one price list, nothing converts it yet
+	if in.Currency != defaultCurrency {
+		return fmt.Errorf("unsupported currency: only %s is accepted", defaultCurrency)
+	}
+
+	if in.Items == nil {
+		in.Items = []Product{}
+	}
+	if msg := checkItemCount(len(in.Items)); msg != "" {
+		return errors.New(msg)
+	}
+	if ie := validateItems(in.Items); ie != nil {
+		return ie
+	}
+	if err := checkStock(in.Items); err != nil {
+		return err
+	}
+	priceItems(in.Items)
+	in.Total = orderTotal(in.Items)
+	return nil
+}
+
+// 400 for a prepareOrder failure
+func writeOrderError(w http.ResponseWriter, err error) {
+	var ie *itemError
+	if errors.As(err, &ie) {
+		writeItemError(w, ie)
+		return
+	}
+	var se *stockError
+	if errors.As(err, &se) {
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":  se.Error(),
+			"status": http.StatusConflict,
+			"item":   se.Index,
+		}, false)
 		return
 	}
+	writeJSONError(w, http.StatusBadRequest, err.Error())
+}
 
-	if r.Method != http.MethodDelete {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+// Dry-run order validation (POST /api/orders/validate), nothing is stored
+func validateOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
-	ordersMu.Lock()
-	defer ordersMu.Unlock()
+	var in Order
+	if err := decodeOrder(r, &in); err != nil {
+		writeBodyError(w, err, err.Error())
+		return
+	}
+
+	if err := prepareOrder(&in); err != nil {
+		detail := map[string]any{"error": err.Error()}
+		var ie *itemError
+		if errors.As(err, &ie) {
+			detail["item"] = ie.Index
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"valid":  false,
+			"errors": []map[string]any{detail},
+		}, wantPretty(r))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"valid": true,
+		"total": in.Total,
+		"items": in.Items,
+	}, wantPretty(r))
+}
+
+// 400 with a JSON body naming the failing item
+func writeItemError(w http.ResponseWriter, e *itemError) {
+	writeJSON(w, http.StatusBadRequest, map[string]any{
+		"error":  e.Error(),
+		"status": http.StatusBadRequest,
+		"item":   e.Index,
+	}, false)
+}
+
+// Copy of an order that shares no slices with the stored one
+func copyOrder(o Order) Order {
+	if o.Items != nil {
+		o.Items = append([]Product{}, o.Items...)
+	}
+	if o.Notes != nil {
+		o.Notes = append([]OrderNote(nil), o.Notes...)
+	}
+	if o.Tags != nil {
+		o.Tags = append([]string(nil), o.Tags...)
+	}
+	return o
+}
+
+// Strip admin-only fields unless the caller is an admin. Email goes too,
+// the ?username= ownership check is only a name match.
+func viewFor(o Order, admin bool) Order {
+	if !admin {
+		o.Notes = nil
+		o.Tags = nil
+		o.Email = ""
+	}
+	return o
+}
 
-	idx := -1
+// Find index of order by ID (caller must hold ordersMu), -1 if missing
+func findOrderIndex(id int) int {
 	for i, o := range orders {
 		if o.ID == id {
-			idx = i
-			break
+			return i
 		}
 	}
-	if idx == -1 {
-		http.Error(w, "not found", http.StatusNotFound)
-		return
-	}
+	return -1
+}
 
-	orders = append(orders[:idx], orders[idx+1:]...)
-	w.WriteHeader(http.StatusNoContent)
+// Like findOrderIndex but soft-deleted orders count as missing
+func findLiveOrderIndex(id int) int {
+	idx := findOrderIndex(id)
+	if idx != -1 && orders[idx].Deleted {
+		return -1
+	}
+	return idx
 }
 
 func main() {
+	startTime = time.Now()
+	// Modern formats ke liye sahi Content-Type, warna browser download kar deta hai
+	mime.AddExtensionType(".webp", "image/webp")
+	mime.AddExtensionType(".avif", "image/avif")
+
+	publicBaseURL = strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	allowedOrigins = splitList(os.Getenv("ALLOWED_ORIGINS"))
+	corsMaxAge = envInt("CORS_MAX_AGE", corsMaxAge)
+	adminToken = os.Getenv("ADMIN_TOKEN")
+	adminUser, adminPass = os.Getenv("ADMIN_USER"), os.Getenv("ADMIN_PASS")
+
+	// Render disk ke liye IMAGES_DIR=/data/images set kar sakte hain
+	imagesDir = os.Getenv("IMAGES_DIR")
+	if imagesDir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			log.Fatal("Failed to get working directory: ", err)
+		}
+		imagesDir = filepath.Join(wd, "images")
+	}
+	orderWebhookURL = os.Getenv("ORDER_WEBHOOK_URL")
+	switch scheme := os.Getenv("PRODUCT_ID_SCHEME"); scheme {
+	case "":
+	case "hash", "sequential":
+		productIDScheme = scheme
+	default:
+		log.Printf("⚠️ Ignoring PRODUCT_ID_SCHEME=%q, using %q", scheme, productIDScheme)
+	}
+	smtpSettings = loadSMTPConfig()
+	maxOrderItems = envInt("MAX_ORDER_ITEMS", maxOrderItems)
+	maxBodyBytes = int64(envInt("MAX_BODY_BYTES", int(maxBodyBytes)))
+	maxUploadBytes = int64(envInt("MAX_UPLOAD_BYTES", int(maxUploadBytes)))
+	imageCacheMaxAge = envInt("IMAGE_CACHE_MAX_AGE", imageCacheMaxAge)
+	maxImagesPerPage = envInt("MAX_PER_PAGE", maxImagesPerPage)
+	if c := os.Getenv("DEFAULT_CURRENCY"); c != "" {
+		if validCurrency(c) {
+			defaultCurrency = c
+		} else {
+			log.Printf("⚠️ Ignoring DEFAULT_CURRENCY=%q, using %s", c, defaultCurrency)
+		}
+	}
+
+	if err := loadOrders(ordersFile); err != nil {
+		log.Fatal("Failed to load orders: ", err)
+	}
+	if err := loadArchive(archiveFile); err != nil {
+		log.Fatal("Failed to load archive: ", err)
+	}
+	// Purane delivered/cancelled orders archive.json mein chale jayenge
+	archiveAfterDays = envInt("ARCHIVE_AFTER_DAYS", archiveAfterDays)
+	archiveInterval = envDuration("ARCHIVE_INTERVAL", archiveInterval)
+	go runArchiver()
+	// categories.json ho to usi se categories, warna built-in list
+	if err := loadCategories(categoriesFile); err != nil {
+		log.Fatal("Failed to load categories: ", err)
+	}
+	if err := loadPrices(pricesFile); err != nil {
+		log.Println("Failed to load prices, all products priced at 0:", err)
+	}
+
+	// kill -HUP se prices.json aur categories.json bina restart reload ho jayenge
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			reloadConfig()
+		}
+	}()
+
 	// 1. app-ads.txt serve karne ke liye ye handler add karein
 	http.HandleFunc("/app-ads.txt", func(w http.ResponseWriter, r *http.Request) {
 		// Yahan apni wahi line likhein jo AdMob ne screenshot mein di thi
@@ -194,41 +1697,42 @@ func main() {
 		w.Header().Set("Content-Type", "text/plain")
 		w.Write([]byte(content))
 	})
-	http.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir("./images"))))
+	http.Handle("/images/", withImageCache(withJSON404(http.StripPrefix("/images/", http.FileServer(http.Dir(imagesDir))))))
+	http.Handle("/images/thumb/", withImageCache(http.HandlerFunc(thumbHandler)))
 
 	// Categories (folders)
-	http.HandleFunc("/api/keychains", func(w http.ResponseWriter, r *http.Request) {
-		serveImagesFromFolder(w, r, "./images/Keychains", "Keychains")
-	})
-	http.HandleFunc("/api/stickers", func(w http.ResponseWriter, r *http.Request) {
-		serveImagesFromFolder(w, r, "./images/Stickers", "Stickers")
-	})
-	http.HandleFunc("/api/pocketwatch", func(w http.ResponseWriter, r *http.Request) {
-		serveImagesFromFolder(w, r, "./images/PocketWatch", "PocketWatch")
-	})
-	http.HandleFunc("/api/bracelet", func(w http.ResponseWriter, r *http.Request) {
-		serveImagesFromFolder(w, r, "./images/Bracelet", "Bracelet")
-	})
-	http.HandleFunc("/api/lockets", func(w http.ResponseWriter, r *http.Request) {
-		serveImagesFromFolder(w, r, "./images/Lockets", "Lockets")
-	})
-	http.HandleFunc("/api/posters", func(w http.ResponseWriter, r *http.Request) {
-		serveImagesFromFolder(w, r, "./images/Posters", "Posters")
-	})
-	http.HandleFunc("/api/anime", func(w http.ResponseWriter, r *http.Request) {
-		serveImagesFromFolder(w, r, "./images/Anime", "Anime")
-	})
-	http.HandleFunc("/api/polaroids", func(w http.ResponseWriter, r *http.Request) {
-		serveImagesFromFolder(w, r, "./images/Polaroids", "Polaroids")
-	})
-	http.HandleFunc("/api/albums", func(w http.ResponseWriter, r *http.Request) {
-		serveImagesFromFolder(w, r, "./images/Albums", "Albums")
-	})
+	http.HandleFunc("/api/categories", categoriesHandler)
+	http.HandleFunc("/api/categories/covers", categoryCoversHandler)
+	http.HandleFunc("/api/category/", categoryHandler)
+	// Legacy per-category routes, e.g. /api/stickers
+	http.HandleFunc("/api/", legacyCategoryHandler)
+
+	http.HandleFunc("/api/search", searchHandler)
+	http.HandleFunc("/", rootHandler)
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/metrics", metricsHandler)
 
 	// Orders API
 	http.HandleFunc("/api/orders", ordersHandler)
 	http.HandleFunc("/api/orders/", orderByIDHandler)
-	http.HandleFunc("/api/hideOrder", hideOrderHandler)
+	http.HandleFunc("/api/orders/validate", validateOrderHandler)
+	http.HandleFunc("/api/hideOrder", requireAdmin(hideOrderHandler))
+	http.HandleFunc("/api/unhideOrder", requireAdmin(unhideOrderHandler))
+
+	// Admin API
+	http.HandleFunc("/api/admin/summary", requireAdmin(adminSummaryHandler))
+	http.HandleFunc("/api/admin/orders/bulkDelete", requireAdmin(bulkDeleteOrdersHandler))
+	http.HandleFunc("/api/admin/orders/byProduct", requireAdmin(ordersByProductHandler))
+	http.HandleFunc("/api/admin/orders/recent", requireAdmin(recentOrdersHandler))
+	http.HandleFunc("/api/admin/orders/search", requireAdmin(searchOrdersHandler))
+	http.HandleFunc("/api/admin/orders/byDay", requireAdmin(ordersByDayHandler))
+	http.HandleFunc("/api/admin/shutdown", requireAdmin(adminShutdownHandler))
+	http.HandleFunc("/api/admin/images/duplicates", requireAdmin(imageDuplicatesHandler))
+	http.HandleFunc("/api/admin/archive", requireAdmin(archiveHandler))
+	http.HandleFunc("/api/admin/reload", requireAdmin(reloadHandler))
+	http.HandleFunc("/api/admin/orders/export.csv", requireAdmin(exportOrdersCSVHandler))
+	http.HandleFunc("/api/admin/orders/stream", requireAdmin(streamOrdersHandler))
+	http.HandleFunc("/api/admin/orders/", requireAdmin(purgeOrderHandler))
 
 	// Render port
 	port := os.Getenv("PORT")
@@ -237,6 +1741,103 @@ func main() {
 	}
 
 	// Render ke liye host "0.0.0.0" hona zaroori hai
-	log.Println("🚀 Server running on port " + port)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+port, withCORS(http.DefaultServeMux)))
+	host := os.Getenv("HOST")
+	if host == "" {
+		host = "0.0.0.0"
+	}
+
+	// Timeouts so slow clients can't hold connections open forever
+	readTimeout := envDuration("READ_TIMEOUT", 15*time.Second)
+	handlerTimeout = envDuration("HANDLER_TIMEOUT", handlerTimeout)
+	srv := &http.Server{
+		Addr:              net.JoinHostPort(host, port),
+		Handler:           withRecover(withRequestID(withLogging(withGzip(withCORS(withRateLimit(withBodyLimit(withTimeout(http.DefaultServeMux)))))))),
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readTimeout,
+		WriteTimeout:      envDuration("WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       envDuration("IDLE_TIMEOUT", 60*time.Second),
+	}
+
+	// Render redeploy par SIGTERM bhejta hai, in-flight requests ko complete hone do
+	idleClosed := make(chan struct{})
+	clean := true // Only read after idleClosed is closed
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		select {
+		case <-sig:
+		case who := <-shutdownRequests:
+			log.Printf("Shutdown triggered by admin (%s)", who)
+		}
+
+		log.Println("Shutting down server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println("Shutdown error:", err)
+			clean = false
+		}
+
+		if err := saveOrders(ordersFile); err != nil {
+			log.Println("Failed to save orders on shutdown:", err)
+			clean = false
+		}
+		close(idleClosed)
+	}()
+
+	logStartupConfig(srv)
+	log.Println("🚀 Server running on " + srv.Addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+
+	<-idleClosed
+	if !clean {
+		log.Println("❌ Server shut down with errors, see above")
+		return
+	}
+	log.Println("✅ Server shut down cleanly")
+}
+
+// "set"/"unset" so secrets never reach the logs
+func redact(v string) string {
+	if v == "" {
+		return "unset"
+	}
+	return "set"
+}
+
+// Absolute form of a relative data file, for logs
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// One key=value line with everything main resolved, secrets redacted
+func logStartupConfig(srv *http.Server) {
+	baseURL := publicBaseURL
+	if baseURL == "" {
+		baseURL = "(from request)"
+	}
+	origins := "*"
+	if len(allowedOrigins) > 0 {
+		origins = strings.Join(allowedOrigins, ",")
+	}
+	basicAuth := "unset"
+	if adminUser != "" && adminPass != "" {
+		basicAuth = "set"
+	}
+	smtpHost := "unset"
+	if smtpSettings.enabled() {
+		smtpHost = net.JoinHostPort(smtpSettings.Host, smtpSettings.Port)
+	}
+
+	log.Printf("config addr=%s images_dir=%q base_url=%s admin_token=%s admin_basic=%s allowed_origins=%s "+
+		"orders_file=%s archive_file=%s prices_file=%s categories=%d currency=%s webhook=%s smtp=%s "+
+		"read_timeout=%s write_timeout=%s handler_timeout=%s",
+		srv.Addr, imagesDir, baseURL, redact(adminToken), basicAuth, origins,
+		absPath(ordersFile), absPath(archiveFile), absPath(pricesFile), len(currentCategories()), defaultCurrency, redact(orderWebhookURL), smtpHost,
+		srv.ReadTimeout, srv.WriteTimeout, handlerTimeout)
 }
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Start from an empty order book persisted under a temp dir
+func resetOrders(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	ordersFile = filepath.Join(dir, "orders.json")
+	imagesDir = dir
+
+	ordersMu.Lock()
+	orders = []Order{}
+	lastOrderID.Store(0)
+	rebuildUsernameIndex()
+	ordersMu.Unlock()
+}
+
+// POST body through ordersHandler, failing the test on anything but 201
+func postOrder(t *testing.T, body string) Order {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	ordersHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("POST /api/orders: status %d, body %s", rec.Code, rec.Body.String())
+		return Order{}
+	}
+	var o Order
+	if err := json.Unmarshal(rec.Body.Bytes(), &o); err != nil {
+		t.Errorf("decode order: %v", err)
+	}
+	return o
+}
+
+const testOrderBody = `{"username":"alice","items":[{"id":1,"url":"http://x/images/Stickers/a.png"}]}`
+
+func TestConcurrentPostsGetUniqueIDs(t *testing.T) {
+	resetOrders(t)
+
+	const n = 100
+	ids := make(chan int, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids <- postOrder(t, testOrderBody).ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := map[int]bool{}
+	for id := range ids {
+		if id <= 0 {
+			t.Fatalf("got non-positive order ID %d", id)
+		}
+		if seen[id] {
+			t.Fatalf("order ID %d issued twice", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != n {
+		t.Fatalf("got %d unique IDs, want %d", len(seen), n)
+	}
+
+	ordersMu.Lock()
+	stored := len(orders)
+	ordersMu.Unlock()
+	if stored != n {
+		t.Fatalf("stored %d orders, want %d", stored, n)
+	}
+}
+
+func TestPostedOrderCreatedAtIsUTC(t *testing.T) {
+	resetOrders(t)
+
+	o := postOrder(t, testOrderBody)
+	raw, err := json.Marshal(o.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(strings.Trim(string(raw), `"`), "Z") {
+		t.Errorf("created_at %s is not in UTC", raw)
+	}
+
+	ordersMu.Lock()
+	loc := orders[0].CreatedAt.Location()
+	ordersMu.Unlock()
+	if loc != time.UTC {
+		t.Errorf("stored CreatedAt location %v, want UTC", loc)
+	}
+}
+
+func TestListingEscapesSpacesInNames(t *testing.T) {
+	imagesDir = t.TempDir()
+	folder := filepath.Join(imagesDir, "Wall Art")
+	if err := os.Mkdir(folder, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, "My Poster (1).jpg"), []byte("jpg"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://shop.test/api/category/Wall%20Art", nil)
+	rec := httptest.NewRecorder()
+	serveImagesFromFolder(rec, req, folder, "Wall Art")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	var products []Product
+	if err := json.Unmarshal(rec.Body.Bytes(), &products); err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 {
+		t.Fatalf("got %d products, want 1", len(products))
+	}
+	want := "http://shop.test/images/Wall%20Art/My%20Poster%20%281%29.jpg"
+	if products[0].URL != want {
+		t.Errorf("URL %s, want %s", products[0].URL, want)
+	}
+}
+
+func TestPostIgnoresServerOwnedFields(t *testing.T) {
+	resetOrders(t)
+
+	postOrder(t, `{"username":"bob","items":[{"id":1,"url":"http://x/images/Stickers/a.png"}],
+		"hidden":true,"deleted":true,"deleted_at":"2020-01-01T00:00:00Z","cancelled_at":"2020-01-01T00:00:00Z"}`)
+
+	ordersMu.Lock()
+	o := orders[0]
+	ordersMu.Unlock()
+	if o.Hidden || o.Deleted || !o.DeletedAt.IsZero() || !o.CancelledAt.IsZero() {
+		t.Errorf("stored order kept client-set fields: hidden=%v deleted=%v deleted_at=%v cancelled_at=%v",
+			o.Hidden, o.Deleted, o.DeletedAt, o.CancelledAt)
+	}
+}
+
+func TestOrderListETagCatchesSameSecondChanges(t *testing.T) {
+	resetOrders(t)
+
+	list := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/orders?username=alice", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		ordersHandler(rec, req)
+		return rec
+	}
+
+	postOrder(t, testOrderBody)
+	first := list("")
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on order list")
+	}
+	if rec := list(etag); rec.Code != http.StatusNotModified {
+		t.Fatalf("unchanged list: status %d, want 304", rec.Code)
+	}
+
+	for range 30 {
+		postOrder(t, testOrderBody)
+	}
+	rec := list(etag)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("after new orders: status %d, want 200", rec.Code)
+	}
+	if lm := rec.Header().Get("Last-Modified"); lm != "" {
+		if at, err := http.ParseTime(lm); err != nil || at.After(time.Now()) {
+			t.Errorf("Last-Modified %q is in the future or invalid", lm)
+		}
+	}
+}
+
+func TestWantsXMLHonoursQValues(t *testing.T) {
+	cases := map[string]bool{
+		"":                                      false,
+		"application/xml":                       true,
+		"text/xml, application/json;q=0.5":      true,
+		"application/xml;q=0, application/json": false,
+		"application/json, application/xml":     false,
+		"application/xml, */*":                  false,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": false,
+	}
+	for accept, want := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+		r.Header.Set("Accept", accept)
+		if got := wantsXML(r); got != want {
+			t.Errorf("Accept %q: wantsXML = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestGetOrderByIDChecksOwner(t *testing.T) {
+	resetOrders(t)
+	o := postOrder(t, testOrderBody)
+
+	for user, want := range map[string]int{"alice": http.StatusOK, "ALICE": http.StatusOK, "mallory": http.StatusNotFound, "": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/api/orders/"+strconv.Itoa(o.ID)+"?username="+user, nil)
+		rec := httptest.NewRecorder()
+		orderByIDHandler(rec, req)
+		if rec.Code != want {
+			t.Errorf("username %q: status %d, want %d", user, rec.Code, want)
+		}
+	}
+}
+
+func TestBulkDeleteKeepsOrdersForAudit(t *testing.T) {
+	resetOrders(t)
+	o := postOrder(t, testOrderBody)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/orders/bulkDelete",
+		strings.NewReader(`{"ids":[`+strconv.Itoa(o.ID)+`,999]}`))
+	rec := httptest.NewRecorder()
+	bulkDeleteOrdersHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+	if len(orders) != 1 || !orders[0].Deleted || orders[0].DeletedAt.IsZero() {
+		t.Fatalf("want order kept and soft-deleted, got %+v", orders)
+	}
+}
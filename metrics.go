@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds (seconds) of the request duration histogram
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Distinct path/status series kept before new ones are folded into "other"
+const maxMetricSeries = 1000
+
+type requestKey struct {
+	path   string
+	status int
+}
+
+var (
+	metricsMu       sync.Mutex
+	requestCounts   = map[requestKey]uint64{}
+	durationCounts  = make([]uint64, len(durationBuckets))
+	durationSum     float64
+	durationSamples uint64
+)
+
+// Label for a request path: the registered route with IDs and filenames
+// collapsed and known category slugs kept. Anything else is "unmatched" so
+// junk paths can't use up the series limit.
+func metricPath(p string) string {
+	switch {
+	case strings.HasPrefix(p, "/images/thumb/"):
+		return "/images/thumb/"
+	case strings.HasPrefix(p, "/images/"):
+		return "/images/"
+	}
+
+	pattern, _ := matchedRoute(p)
+	if pattern == "" {
+		// Legacy /api/{category}
+		if slug, ok := strings.CutPrefix(p, "/api/"); ok {
+			if c, found := findCategory(slug); found {
+				return "/api/" + c.Slug
+			}
+		}
+		return "unmatched"
+	}
+
+	segs, parts := strings.Split(pattern, "/"), strings.Split(p, "/")
+	for i, s := range segs {
+		if s != "*" {
+			continue
+		}
+		switch {
+		case segs[2] == "category" && i == 3:
+			c, ok := findCategory(parts[i])
+			if !ok {
+				return "unmatched"
+			}
+			segs[i] = c.Slug
+		case segs[2] == "category" && i == 4:
+			segs[i] = "{file}"
+		default:
+			segs[i] = "{id}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// Escape a label value for the text format, which only knows \\, \" and \n
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Called by withLogging once per request
+func recordRequest(path string, status int, d time.Duration) {
+	key := requestKey{path: metricPath(path), status: status}
+	secs := d.Seconds()
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if _, ok := requestCounts[key]; !ok && len(requestCounts) >= maxMetricSeries {
+		key.path = "other"
+	}
+	requestCounts[key]++
+
+	for i, le := range durationBuckets {
+		if secs <= le {
+			durationCounts[i]++
+		}
+	}
+	durationSum += secs
+	durationSamples++
+}
+
+// Prometheus text exposition (GET /metrics)
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	ordersMu.Lock()
+	total, hidden := 0, 0
+	for _, o := range orders {
+		if o.Deleted {
+			continue
+		}
+		total++
+		if o.Hidden {
+			hidden++
+		}
+	}
+	ordersMu.Unlock()
+
+	var b strings.Builder
+
+	metricsMu.Lock()
+	keys := make([]requestKey, 0, len(requestCounts))
+	for k := range requestCounts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	b.WriteString("# HELP http_requests_total Total HTTP requests by path and status.\n")
+	b.WriteString("# TYPE http_requests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "http_requests_total{path=\"%s\",status=\"%d\"} %d\n", labelEscaper.Replace(k.path), k.status, requestCounts[k])
+	}
+
+	b.WriteString("# HELP http_request_duration_seconds HTTP request latency.\n")
+	b.WriteString("# TYPE http_request_duration_seconds histogram\n")
+	for i, le := range durationBuckets {
+		fmt.Fprintf(&b, "http_request_duration_seconds_bucket{le=\"%g\"} %d\n", le, durationCounts[i])
+	}
+	fmt.Fprintf(&b, "http_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", durationSamples)
+	fmt.Fprintf(&b, "http_request_duration_seconds_sum %g\n", durationSum)
+	fmt.Fprintf(&b, "http_request_duration_seconds_count %d\n", durationSamples)
+	metricsMu.Unlock()
+
+	b.WriteString("# HELP zoneout_orders Orders currently stored.\n")
+	b.WriteString("# TYPE zoneout_orders gauge\n")
+	fmt.Fprintf(&b, "zoneout_orders %d\n", total)
+	b.WriteString("# HELP zoneout_hidden_orders Stored orders that are hidden.\n")
+	b.WriteString("# TYPE zoneout_hidden_orders gauge\n")
+	fmt.Fprintf(&b, "zoneout_hidden_orders %d\n", hidden)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
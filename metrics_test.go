@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestMetricPathBoundsLabels(t *testing.T) {
+	cases := map[string]string{
+		"/api/orders/12":               "/api/orders/{id}",
+		"/api/category/stickers/a.png": "/api/category/stickers/{file}",
+		"/api/category/no-such-thing":  "unmatched",
+		"/api/\x01":                    "unmatched",
+		"/wp-login.php":                "unmatched",
+	}
+	for path, want := range cases {
+		if got := metricPath(path); got != want {
+			t.Errorf("metricPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	if got := labelEscaper.Replace("a\\b\"c\nd"); got != `a\\b\"c\nd` {
+		t.Errorf("escaped label %q", got)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ctxKey int
+
+const requestIDKey ctxKey = iota
+
+// Request ID set by withRequestID, "" outside a request
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Random RFC 4122 version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Accept client IDs only if short and printable, they end up in logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Reuse the incoming X-Request-ID or generate one, echo it and put it in the context
+func withRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newUUID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// Turn a handler panic into a logged stack trace and a JSON 500. Sits
+// outermost, so the request ID comes from the header withRequestID set.
+func withRecover(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err) // deliberate abort, let net/http drop the connection
+			}
+			stack := debug.Stack()
+			if p, ok := err.(handlerPanic); ok {
+				err, stack = p.value, p.stack
+			}
+			log.Printf("panic request_id=%s method=%s path=%q: %v\n%s",
+				w.Header().Get("X-Request-ID"), r.Method, r.URL.Path, err, stack)
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Panic value re-raised across TimeoutHandler's goroutine with the original stack
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+// Capture the stack where a handler panicked, before TimeoutHandler re-panics
+func keepPanicStack(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				panic(handlerPanic{value: err, stack: debug.Stack()})
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ResponseWriter wrapper that records status code and bytes written
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Lets http.ResponseController reach Flush etc. on the wrapped writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Log one line per request: request ID, method, path, status, bytes, duration
+func withLogging(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err != nil && rw.status == 0 {
+				rw.status = http.StatusInternalServerError // withRecover writes it once we re-panic
+			}
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+			recordRequest(r.URL.Path, rw.status, time.Since(start))
+			log.Printf("request_id=%s method=%s path=%q status=%d bytes=%d duration=%s",
+				requestIDFromContext(r.Context()), r.Method, r.URL.Path, rw.status, rw.bytes, time.Since(start))
+			if err != nil {
+				panic(err)
+			}
+		}()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// Replaces a wrapped handler's plain-text 404 body with the JSON error shape
+type notFoundWriter struct {
+	http.ResponseWriter
+	notFound bool
+}
+
+func (nw *notFoundWriter) WriteHeader(status int) {
+	if status == http.StatusNotFound {
+		nw.notFound = true
+		nw.Header().Del("Content-Length")
+		writeJSONError(nw.ResponseWriter, http.StatusNotFound, "not found")
+		return
+	}
+	nw.ResponseWriter.WriteHeader(status)
+}
+
+func (nw *notFoundWriter) Write(b []byte) (int, error) {
+	if nw.notFound {
+		return len(b), nil // Drop the original 404 text
+	}
+	return nw.ResponseWriter.Write(b)
+}
+
+func (nw *notFoundWriter) Unwrap() http.ResponseWriter {
+	return nw.ResponseWriter
+}
+
+// JSON 404s for handlers like http.FileServer that write text errors
+func withJSON404(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&notFoundWriter{ResponseWriter: w}, r)
+	})
+}
+
+// Browser cache lifetime for images in seconds (IMAGE_CACHE_MAX_AGE)
+var imageCacheMaxAge = 86400
+
+// Sets Cache-Control on successful responses only, errors stay uncached
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (cw *cacheControlWriter) WriteHeader(status int) {
+	if !cw.wroteHeader && status < http.StatusBadRequest {
+		cw.Header().Set("Cache-Control", cw.value)
+	}
+	cw.wroteHeader = true
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheControlWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK) // implicit 200
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Product images rarely change, let browsers keep them
+func withImageCache(h http.Handler) http.Handler {
+	value := "public, max-age=" + strconv.Itoa(imageCacheMaxAge)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&cacheControlWriter{ResponseWriter: w, value: value}, r)
+	})
+}
+
+// Request body caps, from MAX_BODY_BYTES / MAX_UPLOAD_BYTES (set in main)
+var (
+	maxBodyBytes   int64 = 1 << 20
+	maxUploadBytes int64 = 32 << 20 // Image uploads legitimately run to several MB
+)
+
+// Cap request bodies so a huge POST can't exhaust memory, reads past the
+// limit fail with *http.MaxBytesError which handlers turn into a 413
+func withBodyLimit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := maxBodyBytes
+		if strings.HasSuffix(r.URL.Path, "/upload") {
+			limit = maxUploadBytes
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Per-request deadline (HANDLER_TIMEOUT), keep below WriteTimeout
+var handlerTimeout = 20 * time.Second
+
+// Routes that write their response as they go
+var streamedRoutes = map[string]bool{
+	"/api/admin/orders/stream":     true,
+	"/api/admin/orders/export.csv": true,
+}
+
+// Abort slow handlers with a JSON 503, the deadline also cancels r.Context()
+// so long loops can stop early. Uploads are exempt since large multipart
+// bodies are legitimately slow, and streamed responses (NDJSON, CSV export)
+// since TimeoutHandler buffers the whole response.
+func withTimeout(h http.Handler) http.Handler {
+	body, _ := json.Marshal(map[string]any{
+		"error":  "request timed out",
+		"status": http.StatusServiceUnavailable,
+	})
+	th := http.TimeoutHandler(keepPanicStack(h), handlerTimeout, string(body)+"\n")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/upload") || streamedRoutes[r.URL.Path] {
+			h.ServeHTTP(w, r)
+			return
+		}
+		th.ServeHTTP(timeoutWriter{w}, r)
+	})
+}
+
+// Labels TimeoutHandler's bare 503 body as JSON
+type timeoutWriter struct {
+	http.ResponseWriter
+}
+
+func (tw timeoutWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && tw.Header().Get("Content-Type") == "" {
+		tw.Header().Set("Content-Type", "application/json")
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
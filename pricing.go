@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Currency for orders that don't name one (DEFAULT_CURRENCY), prices.json is in this currency
+var defaultCurrency = "INR"
+
+// ISO 4217 shape check, three uppercase letters
+func validCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Default price per category folder, loaded from pricesFile
+var (
+	categoryPrices = map[string]float64{}
+	pricesMu       sync.RWMutex
+	pricesFile     = "prices.json"
+)
+
+// Load {"Stickers": 29, ...} from path, replacing the current prices
+func loadPrices(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	loaded := map[string]float64{}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+
+	for _, c := range currentCategories() {
+		if _, ok := loaded[c.Folder]; !ok {
+			log.Printf("Warning: no price for category %s in %s, defaulting to 0", c.Folder, path)
+		}
+	}
+
+	pricesMu.Lock()
+	categoryPrices = loaded
+	pricesMu.Unlock()
+	return nil
+}
+
+// Price of every product in a category folder, 0 when unpriced
+func priceFor(folder string) float64 {
+	pricesMu.RLock()
+	defer pricesMu.RUnlock()
+	return categoryPrices[folder]
+}
+
+// Category folder from an image URL like .../images/Stickers/foo.png
+func categoryFromURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	_, rest, ok := strings.Cut(u.Path, "/images/")
+	if !ok {
+		return ""
+	}
+	folder, _, _ := strings.Cut(rest, "/")
+	return folder
+}
+
+// Set item prices from server config (client-sent prices are never trusted)
+// and default missing quantities to 1, filling in each line subtotal
+func priceItems(items []Product) {
+	for i := range items {
+		items[i].Price = priceFor(categoryFromURL(items[i].URL))
+		if items[i].Quantity == 0 {
+			items[i].Quantity = 1
+		}
+		items[i].Subtotal = lineSubtotal(items[i])
+		items[i].Available = nil // listing-only field
+	}
+}
+
+// Price x quantity for one line, rounded to paise
+func lineSubtotal(p Product) float64 {
+	return math.Round(p.Price*float64(p.Quantity)*100) / 100
+}
+
+// Sum of line subtotals, so the total always matches the lines shown
+func orderTotal(items []Product) float64 {
+	var total float64
+	for _, p := range items {
+		total += lineSubtotal(p)
+	}
+	return math.Round(total*100) / 100
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-IP token bucket: burst of rateLimitBurst, refilled at rateLimitPerMinute
+const (
+	rateLimitPerMinute = 60
+	rateLimitBurst     = 60
+	rateLimitIdle      = 10 * time.Minute // Buckets unused this long are evicted
+)
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// Take a token for ip, returns wait time until next token when empty
+func (l *rateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	perSecond := float64(rateLimitPerMinute) / 60
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: rateLimitBurst}
+		l.buckets[ip] = b
+	} else {
+		b.tokens = math.Min(rateLimitBurst, b.tokens+now.Sub(b.lastSeen).Seconds()*perSecond)
+	}
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Drop buckets that have been idle, keeps the map from growing forever
+func (l *rateLimiter) evictIdle(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ip, b := range l.buckets {
+		if now.Sub(b.lastSeen) > rateLimitIdle {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// Client IP, the last X-Forwarded-For hop (the one Render's proxy appends),
+// else RemoteAddr. Earlier hops come from the client and can be made up.
+func clientIP(r *http.Request) string {
+	if fwd := strings.Join(r.Header.Values("X-Forwarded-For"), ","); fwd != "" {
+		hops := strings.Split(fwd, ",")
+		if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Rate limit /api/ requests per client IP, 429 with Retry-After when exceeded
+func withRateLimit(h http.Handler) http.Handler {
+	l := &rateLimiter{buckets: map[string]*bucket{}}
+	go func() {
+		for now := range time.Tick(time.Minute) {
+			l.evictIdle(now)
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Static images are not limited, a gallery page loads dozens at once
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.Method == http.MethodOptions {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ok, wait := l.allow(clientIP(r), time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// Printable receipt, kept deliberately plain so it prints well
+var receiptTmpl = template.Must(template.New("receipt").Funcs(template.FuncMap{"itemName": itemName}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Receipt #{{.ID}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; color: #222; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: .4em; border-bottom: 1px solid #ddd; text-align: left; }
+td.num, th.num { text-align: right; }
+tfoot td { font-weight: bold; border-bottom: none; }
+</style>
+</head>
+<body>
+<h1>Zone Out receipt</h1>
+<p>Order #{{.ID}} for {{.Username}}<br>
+Placed {{.CreatedAt.Format "02 Jan 2006 15:04 MST"}}<br>
+Status: {{.Status}}</p>
+<table>
+<thead><tr><th>Item</th><th class="num">Qty</th><th class="num">Price</th><th class="num">Subtotal</th></tr></thead>
+<tbody>
+{{- range .Items}}
+<tr><td>{{itemName .URL}}</td><td class="num">{{.Quantity}}</td><td class="num">{{printf "%.2f" .Price}}</td><td class="num">{{printf "%.2f" .Subtotal}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot><tr><td colspan="3">Total</td><td class="num">{{printf "%.2f" .Total}} {{.Currency}}</td></tr></tfoot>
+</table>
+</body>
+</html>
+`))
+
+// Human-readable item name, the image filename without its path
+func itemName(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Path == "" {
+		return raw
+	}
+	return path.Base(u.Path)
+}
+
+// Printable HTML receipt (GET /api/orders/{id}/receipt?username=), customers see only their own
+func receiptHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	admin := isAdmin(r)
+	username := normalizeUsername(r.URL.Query().Get("username"))
+
+	ordersMu.Lock()
+	idx := findLiveOrderIndex(id)
+	if idx == -1 || (!admin && (normalizeUsername(orders[idx].Username) != username || orders[idx].Hidden)) {
+		ordersMu.Unlock()
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	o := viewFor(copyOrder(orders[idx]), admin)
+	ordersMu.Unlock()
+
+	var buf bytes.Buffer
+	if err := receiptTmpl.Execute(&buf, o); err != nil {
+		log.Printf("render receipt %d: %v", id, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to render receipt")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-category list of sold-out filenames, e.g. images/Posters/out_of_stock.json
+const outOfStockFile = "out_of_stock.json"
+
+type stockEntry struct {
+	modTime time.Time
+	names   map[string]bool
+}
+
+// Parsed out_of_stock.json per folder, re-read whenever the file's mtime changes
+var (
+	stockCache   = map[string]stockEntry{}
+	stockCacheMu sync.Mutex
+)
+
+// Sold-out filenames in a category folder, empty when there's no list
+func outOfStock(folder string) map[string]bool {
+	p := filepath.Join(folder, outOfStockFile)
+	info, err := os.Stat(p)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("stock: %v", err)
+		}
+		return nil
+	}
+
+	stockCacheMu.Lock()
+	defer stockCacheMu.Unlock()
+	if e, ok := stockCache[folder]; ok && e.modTime.Equal(info.ModTime()) {
+		return e.names
+	}
+
+	var list []string
+	data, err := os.ReadFile(p)
+	if err == nil {
+		err = json.Unmarshal(data, &list)
+	}
+	if err != nil {
+		// A broken list shouldn't take the category down, everything stays available
+		log.Printf("stock: ignoring %s: %v", p, err)
+		return nil
+	}
+	names := make(map[string]bool, len(list))
+	for _, n := range list {
+		names[n] = true
+	}
+	stockCache[folder] = stockEntry{modTime: info.ModTime(), names: names}
+	return names
+}
+
+// Forget every parsed out_of_stock.json
+func clearStockCache() {
+	stockCacheMu.Lock()
+	stockCache = map[string]stockEntry{}
+	stockCacheMu.Unlock()
+}
+
+// Stable fingerprint of a folder's sold-out list, for listing ETags
+func stockFingerprint(folder string) string {
+	names := make([]string, 0)
+	for n := range outOfStock(folder) {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\x00")
+}
+
+// Category folder and filename from an image URL like .../images/Stickers/foo.png
+func imageFromURL(raw string) (folder, name string) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", ""
+	}
+	_, rest, ok := strings.Cut(u.Path, "/images/")
+	if !ok {
+		return "", ""
+	}
+	folder, file, ok := strings.Cut(rest, "/")
+	if !ok || file == "" {
+		return folder, ""
+	}
+	return folder, path.Base(file)
+}
+
+// Order item that can't be sold, reported as a 409
+type stockError struct {
+	Index int
+	Name  string
+}
+
+func (e *stockError) Error() string {
+	return fmt.Sprintf("item %d: %s is out of stock", e.Index, e.Name)
+}
+
+// First item that is listed as out of stock, nil when all can be sold
+func checkStock(items []Product) error {
+	for i, p := range items {
+		folder, name := imageFromURL(p.URL)
+		if folder == "" || name == "" || !validCategoryFolder(folder) {
+			continue
+		}
+		if outOfStock(filepath.Join(imagesDir, folder))[name] {
+			return &stockError{Index: i, Name: name}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Orders are persisted here so they survive restarts/redeploys
+var ordersFile = "orders.json"
+
+// Serializes writers so an older snapshot never overwrites a newer one
+var saveMu sync.Mutex
+
+// Load orders from disk, missing file means start with an empty list
+func loadOrders(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		ordersMu.Lock()
+		touchOrders()
+		ordersMu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var loaded []Order
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+
+	ordersMu.Lock()
+	defer ordersMu.Unlock()
+
+	orders = loaded
+	if orders == nil {
+		orders = []Order{}
+	}
+
+	// Continue IDs after the highest stored one; older files may carry local offsets
+	maxID := 0
+	for i, o := range orders {
+		if o.ID > maxID {
+			maxID = o.ID
+		}
+		orders[i].CreatedAt = o.CreatedAt.UTC()
+		orders[i].CancelledAt = o.CancelledAt.UTC()
+		orders[i].DeletedAt = o.DeletedAt.UTC()
+		for j := range o.Notes {
+			o.Notes[j].CreatedAt = o.Notes[j].CreatedAt.UTC()
+		}
+		// Orders saved before currencies existed were all priced in the default
+		if o.Currency == "" {
+			orders[i].Currency = defaultCurrency
+		}
+		// Orders saved before quantities and subtotals existed, those lines were one unit each
+		for j := range o.Items {
+			if o.Items[j].Quantity == 0 {
+				o.Items[j].Quantity = 1
+			}
+			if o.Items[j].Subtotal == 0 {
+				o.Items[j].Subtotal = lineSubtotal(o.Items[j])
+			}
+		}
+	}
+	lastOrderID.Store(int64(maxID))
+	rebuildUsernameIndex()
+	touchOrders()
+	return nil
+}
+
+// Save orders to disk (temp file + rename so a crash never leaves half a file)
+func saveOrders(path string) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	ordersMu.Lock()
+	data, err := json.MarshalIndent(orders, "", "  ")
+	ordersMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Replace path with data via a temp file + rename in the same directory
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Save after a mutation, must be called without holding ordersMu
+func persistOrders() {
+	if err := saveOrders(ordersFile); err != nil {
+		log.Println("Failed to save orders:", err)
+	}
+}
+
+// Last order mutation, guarded by ordersMu. The time (whole seconds, never
+// ahead of the clock) backs Last-Modified; the counter backs the ETag so two
+// changes within one second are still told apart.
+var (
+	ordersModified time.Time
+	ordersVersion  uint64
+)
+
+// Distinguishes ETags across restarts, the counter starts over on boot
+var ordersEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// Record a mutation (caller must hold ordersMu)
+func touchOrders() {
+	ordersModified = time.Now().UTC().Truncate(time.Second)
+	ordersVersion++
+}
+
+// Weak ETag for the order list as of version
+func ordersETag(version uint64) string {
+	return `W/"orders-` + ordersEpoch + "-" + strconv.FormatUint(version, 10) + `"`
+}
+
+// True when the client's copy is current. If-None-Match wins when sent, as
+// in RFC 9110; If-Modified-Since is only trustworthy because Last-Modified
+// isn't handed out until its second is over (see orderCacheHeaders).
+func ordersNotModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	return notModifiedSince(r, modified)
+}
+
+// Set ETag, plus Last-Modified once no further change can share its second
+func orderCacheHeaders(w http.ResponseWriter, etag string, modified time.Time) {
+	w.Header().Set("ETag", etag)
+	if modified.Before(time.Now().UTC().Truncate(time.Second)) {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	}
+}
+
+// True when If-Modified-Since covers the last change
+func notModifiedSince(r *http.Request, modified time.Time) bool {
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return !modified.After(ims)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOrdersNormalisesTimesToUTC(t *testing.T) {
+	resetOrders(t)
+
+	path := filepath.Join(t.TempDir(), "orders.json")
+	data := `[{"id":7,"username":"alice","items":[],"status":"cancelled",
+		"created_at":"2024-05-01T10:30:00+05:30","cancelled_at":"2024-05-02T09:00:00-04:00"}]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadOrders(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ordersMu.Lock()
+	o := orders[0]
+	ordersMu.Unlock()
+
+	if o.CreatedAt.Location() != time.UTC || o.CancelledAt.Location() != time.UTC {
+		t.Fatalf("got locations %v / %v, want UTC", o.CreatedAt.Location(), o.CancelledAt.Location())
+	}
+	if want := time.Date(2024, 5, 1, 5, 0, 0, 0, time.UTC); !o.CreatedAt.Equal(want) {
+		t.Errorf("CreatedAt %v, want %v", o.CreatedAt, want)
+	}
+	if got := o.CreatedAt.Format(time.RFC3339); got != "2024-05-01T05:00:00Z" {
+		t.Errorf("CreatedAt formats as %s", got)
+	}
+}
+
+func TestLoadOrdersBackfillsLegacyQuantity(t *testing.T) {
+	resetOrders(t)
+
+	path := filepath.Join(t.TempDir(), "orders.json")
+	data := `[{"id":1,"username":"alice","total":49,"items":[{"id":3,"url":"http://x/images/Stickers/a.png","price":49}]}]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadOrders(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ordersMu.Lock()
+	item := orders[0].Items[0]
+	ordersMu.Unlock()
+	if item.Quantity != 1 || item.Subtotal != 49 {
+		t.Errorf("got quantity %d subtotal %v, want 1 and 49", item.Quantity, item.Subtotal)
+	}
+}
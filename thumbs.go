@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Generated thumbnails are cached here as thumbs/<width>/<Folder>/<file>
+var thumbsDir = "thumbs"
+
+const defaultThumbWidth = 200
+
+// Widths thumbnails are actually rendered at, so each image has a handful of
+// cached variants rather than one per requested pixel width
+var thumbWidths = []int{100, 200, 400, 800, 1200}
+
+// Smallest rendered width covering the requested one, capped at the largest
+func thumbWidth(requested int) int {
+	for _, w := range thumbWidths {
+		if requested <= w {
+			return w
+		}
+	}
+	return thumbWidths[len(thumbWidths)-1]
+}
+
+// Serve a resized image (GET /images/thumb/{category}/{file}?w=200)
+func thumbHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/images/thumb/")
+	folder, name, ok := strings.Cut(rest, "/")
+	if !ok || !validCategoryFolder(folder) || name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	width := queryInt(r, "w", defaultThumbWidth)
+	if width == 0 {
+		width = defaultThumbWidth
+	}
+	width = thumbWidth(width)
+
+	src := filepath.Join(imagesDir, folder, name)
+	if _, err := os.Stat(src); err != nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	thumb := filepath.Join(thumbsDir, strconv.Itoa(width), folder, name)
+	if _, err := os.Stat(thumb); err == nil {
+		http.ServeFile(w, r, thumb)
+		return
+	}
+
+	if err := makeThumb(r.Context(), src, thumb, width); err != nil {
+		if r.Context().Err() != nil {
+			return // Timed out or client left, nobody is reading the response
+		}
+		// Unsupported format or already small enough, original is the best we have
+		http.ServeFile(w, r, src)
+		return
+	}
+	http.ServeFile(w, r, thumb)
+}
+
+// Only real category folders can be thumbnailed
+func validCategoryFolder(folder string) bool {
+	for _, c := range currentCategories() {
+		if c.Folder == folder {
+			return true
+		}
+	}
+	return false
+}
+
+var errNoThumb = errors.New("thumbnail not needed")
+
+// Decode src, scale to width keeping aspect ratio and write it to dst.
+// Gives up with ctx's error once the request is cancelled.
+func makeThumb(ctx context.Context, src, dst string, width int) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	img, format, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b := img.Bounds()
+	if b.Dx() <= width {
+		return errNoThumb // Never upscale
+	}
+	height := max(1, b.Dy()*width/b.Dx())
+	scaled, err := scaleImage(ctx, img, width, height)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(tmp, scaled, &jpeg.Options{Quality: 80})
+	case "png":
+		err = png.Encode(tmp, scaled)
+	default:
+		err = errors.New("unsupported format " + format)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// Box-filter downscale, averages every source pixel covering a target pixel
+func scaleImage(ctx context.Context, img image.Image, width, height int) (*image.NRGBA, error) {
+	b := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				off := sy*src.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[off])
+					g += int(src.Pix[off+1])
+					bl += int(src.Pix[off+2])
+					a += int(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Multipart parts beyond this stay on disk in temp files while parsing
+const uploadMemory = 32 << 20
+
+// Canonical extension per sniffed image type
+var sniffedImageExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Save uploaded images into a category (POST /api/category/{name}/upload, admin only)
+func uploadImagesHandler(w http.ResponseWriter, r *http.Request, c Category) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		writeBodyError(w, err, "invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var headers []*multipart.FileHeader
+	for _, fhs := range r.MultipartForm.File {
+		headers = append(headers, fhs...)
+	}
+	if len(headers) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "no files uploaded")
+		return
+	}
+
+	dir := c.Dir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to create category folder")
+		return
+	}
+
+	var saved []string
+	for _, fh := range headers {
+		name, err := saveUploadedImage(dir, fh)
+		if err != nil {
+			// All or nothing, don't leave half an upload behind
+			for _, s := range saved {
+				os.Remove(filepath.Join(dir, s))
+			}
+			writeJSONError(w, http.StatusBadRequest, fh.Filename+": "+err.Error())
+			return
+		}
+		saved = append(saved, name)
+	}
+	bustDirCache(dir)
+
+	// Return the new entries exactly as the listing will show them
+	files, err := readImageDir(dir)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to read category")
+		return
+	}
+	products := folderProducts(requestBaseURL(r), c.Folder, files)
+	created := []Product{}
+	for i, f := range files {
+		for _, name := range saved {
+			if f.Name == name {
+				created = append(created, products[i])
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusCreated, created, wantPretty(r))
+}
+
+// Sniff, sanitize and write one upload, returns the stored filename
+func saveUploadedImage(dir string, fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", errors.New("empty file")
+	}
+	ext, ok := sniffedImageExts[http.DetectContentType(head[:n])]
+	if !ok {
+		return "", errors.New("not an image")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	name, err := uniqueFilename(dir, sanitizeFilename(fh.Filename, ext))
+	if err != nil {
+		return "", err
+	}
+
+	// O_EXCL so two concurrent uploads never clobber each other
+	out, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	return name, out.Close()
+}
+
+// Strip directories and odd characters, extension is forced to match the content
+func sanitizeFilename(name, ext string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+
+	var b strings.Builder
+	for _, r := range stem {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '_', r == ' ', r == '(', r == ')':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	stem = strings.Trim(b.String(), " _")
+	if stem == "" {
+		stem = "image"
+	}
+	return stem + ext
+}
+
+// Add -1, -2, ... before the extension until the name is free
+func uniqueFilename(dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 1; i < 1000; i++ {
+		if _, err := os.Stat(filepath.Join(dir, candidate)); errors.Is(err, os.ErrNotExist) {
+			return candidate, nil
+		}
+		candidate = stem + "-" + strconv.Itoa(i) + ext
+	}
+	return "", errors.New("too many files with this name")
+}
+
+// Remove an image file from a category (admin only)
+func deleteImageHandler(w http.ResponseWriter, r *http.Request, c Category, name string) {
+	// Only a bare filename, nothing that could climb out of the category folder
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		writeJSONError(w, http.StatusBadRequest, "invalid filename")
+		return
+	}
+	// Images only: dotfiles and out_of_stock.json live here too
+	if _, ok := imageExts[strings.ToLower(filepath.Ext(name))]; !ok || strings.HasPrefix(name, ".") {
+		writeJSONError(w, http.StatusBadRequest, "invalid filename: only image files can be deleted")
+		return
+	}
+
+	dir := c.Dir()
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if err := os.Remove(path); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to delete image")
+		return
+	}
+	bustDirCache(dir)
+
+	// Cached thumbnails of the image are stale too
+	thumbs, _ := filepath.Glob(filepath.Join(thumbsDir, "*", c.Folder, name))
+	for _, t := range thumbs {
+		os.Remove(t)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
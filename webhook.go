@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Fulfillment webhook from ORDER_WEBHOOK_URL (read in main), disabled when empty
+var orderWebhookURL string
+
+const webhookAttempts = 3
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Notify the webhook about a new order in the background, never blocks the caller
+func notifyOrderCreated(o Order) {
+	if orderWebhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(o)
+	if err != nil {
+		log.Println("Webhook marshal failed:", err)
+		return
+	}
+
+	go func() {
+		backoff := time.Second
+		for attempt := 1; attempt <= webhookAttempts; attempt++ {
+			err := postWebhook(body)
+			if err == nil {
+				return
+			}
+			log.Printf("Webhook for order %d failed (attempt %d/%d): %v", o.ID, attempt, webhookAttempts, err)
+			if attempt < webhookAttempts {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+		}
+	}()
+}
+
+func postWebhook(body []byte) error {
+	resp, err := webhookClient.Post(orderWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}